@@ -0,0 +1,397 @@
+// Package apitest provides an in-process fake of the TensorDock marketplace
+// API for tests that must not touch the network.
+package apitest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+)
+
+const (
+	APIKey   = "test-key"
+	APIToken = "test-token"
+)
+
+//go:embed testdata/hostnodes.json
+var hostnodesFixture []byte
+
+// Failure describes an injected failure for the next call of an endpoint.
+type Failure struct {
+	// Status is the HTTP status code of the answer, 200 when zero.
+	Status int
+	// Message is sent as `error` with `success` set to false.
+	Message string
+	// HTML answers with the marketplace HTML error page.
+	HTML bool
+	// Reset drops the connection without answering.
+	Reset bool
+}
+
+// Server is a fake marketplace holding servers, stock and billing in memory.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	servers  map[string]*api.VirtualMachine
+	stock    map[string]map[string]interface{}
+	billing  api.BillingDetails
+	failures map[string][]Failure
+	calls    map[string]int
+	nextID   int
+}
+
+// NewServer starts a fake marketplace seeded with the hostnodes fixture. It
+// is closed automatically when the test ends.
+func NewServer(t testing.TB) *Server {
+	var fixture struct {
+		HostNodes map[string]map[string]interface{} `json:"hostnodes"`
+	}
+	if err := json.Unmarshal(hostnodesFixture, &fixture); err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		servers:  map[string]*api.VirtualMachine{},
+		stock:    fixture.HostNodes,
+		billing:  api.BillingDetails{Balance: 42.5, HourlySpendingRate: 0.5},
+		failures: map[string][]Failure{},
+		calls:    map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/list", s.handle(s.list))
+	mux.HandleFunc("/get/single", s.handle(s.get))
+	mux.HandleFunc("/deploy/single", s.handle(s.deploy))
+	mux.HandleFunc("/modify/single", s.handle(s.modify))
+	mux.HandleFunc("/start/single", s.handle(s.setStatus("running")))
+	mux.HandleFunc("/stop/single", s.handle(s.setStatus("stopped")))
+	mux.HandleFunc("/restart/single", s.handle(s.setStatus("running")))
+	mux.HandleFunc("/delete/single", s.handle(s.delete))
+	mux.HandleFunc("/deploy/status", s.handle(s.status))
+	mux.HandleFunc("/billing", s.handle(s.billingDetails))
+	mux.HandleFunc("/deploy/hostnodes", s.handle(s.hostnodes))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Client returns an api.Client talking to the fake with valid credentials
+// and a retry policy fast enough for tests.
+func (s *Server) Client(opts ...api.Option) *api.Client {
+	opts = append([]api.Option{api.WithRetry(api.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+	})}, opts...)
+
+	return api.NewClient(s.URL, APIKey, APIToken, false, "", opts...)
+}
+
+// FailNext queues failures served, in order, by the next calls to endpoint
+// (e.g. "get/single").
+func (s *Server) FailNext(endpoint string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[endpoint] = append(s.failures[endpoint], failures...)
+}
+
+// Calls returns how many requests endpoint received.
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[endpoint]
+}
+
+// AddServer stores vm under id, as if it had been deployed.
+func (s *Server) AddServer(id string, vm api.VirtualMachine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.servers[id] = &vm
+}
+
+// VM returns a copy of the server stored under id.
+func (s *Server) VM(id string) (api.VirtualMachine, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vm, ok := s.servers[id]
+	if !ok {
+		return api.VirtualMachine{}, false
+	}
+	return *vm, true
+}
+
+// SetGPUStock changes the available amount of a GPU model on a hostnode.
+func (s *Server) SetGPUStock(hostnode, gpuModel string, amount int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gpus := s.stock[hostnode]["specs"].(map[string]interface{})["gpu"].(map[string]interface{})
+	gpus[gpuModel].(map[string]interface{})["amount"] = amount
+}
+
+type handlerFunc func(form map[string]string) (map[string]interface{}, error)
+
+// apiFailure is returned by handlers for a `success: false` answer.
+type apiFailure string
+
+func (f apiFailure) Error() string { return string(f) }
+
+func (s *Server) handle(fn handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint := strings.TrimPrefix(r.URL.Path, "/")
+
+		s.mu.Lock()
+		s.calls[endpoint]++
+		var failure *Failure
+		if queue := s.failures[endpoint]; len(queue) > 0 {
+			failure = &queue[0]
+			s.failures[endpoint] = queue[1:]
+		}
+		s.mu.Unlock()
+
+		if failure != nil {
+			serveFailure(w, *failure)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+
+		form := map[string]string{}
+		for key := range r.Form {
+			form[key] = r.Form.Get(key)
+		}
+
+		if endpoint != "deploy/hostnodes" && (form["api_key"] != APIKey || form["api_token"] != APIToken) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": "Invalid API key or token"})
+			return
+		}
+
+		s.mu.Lock()
+		body, err := fn(form)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+func serveFailure(w http.ResponseWriter, failure Failure) {
+	status := failure.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	switch {
+	case failure.Reset:
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	case failure.HTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprint(w, "<html><body><h1>Something went wrong</h1></body></html>")
+	default:
+		writeJSON(w, status, map[string]interface{}{"success": false, "error": failure.Message})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// list omits the `success` key, like the real endpoint does on success.
+func (s *Server) list(form map[string]string) (map[string]interface{}, error) {
+	vms := map[string]api.VirtualMachine{}
+	for id, vm := range s.servers {
+		vms[id] = *vm
+	}
+	return map[string]interface{}{"virtualmachines": vms}, nil
+}
+
+// get answers `success` as a string boolean, like the real endpoint.
+func (s *Server) get(form map[string]string) (map[string]interface{}, error) {
+	vm, ok := s.servers[form["server"]]
+	if !ok {
+		return nil, apiFailure("Server not found")
+	}
+	return map[string]interface{}{"success": "true", "virtualmachines": vm}, nil
+}
+
+func (s *Server) status(form map[string]string) (map[string]interface{}, error) {
+	vm, ok := s.servers[form["server"]]
+	if !ok {
+		return nil, apiFailure("Server not found")
+	}
+	return map[string]interface{}{"success": true, "status": vm.Status}, nil
+}
+
+func (s *Server) setStatus(status string) handlerFunc {
+	return func(form map[string]string) (map[string]interface{}, error) {
+		vm, ok := s.servers[form["server"]]
+		if !ok {
+			return nil, apiFailure("Server not found")
+		}
+		vm.Status = status
+		return map[string]interface{}{"success": true}, nil
+	}
+}
+
+func (s *Server) delete(form map[string]string) (map[string]interface{}, error) {
+	if _, ok := s.servers[form["server"]]; !ok {
+		return nil, apiFailure("Server not found")
+	}
+	delete(s.servers, form["server"])
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (s *Server) billingDetails(form map[string]string) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"success":              true,
+		"balance":              s.billing.Balance,
+		"hourly_spending_rate": s.billing.HourlySpendingRate,
+	}, nil
+}
+
+func (s *Server) hostnodes(form map[string]string) (map[string]interface{}, error) {
+	return map[string]interface{}{"success": "true", "hostnodes": s.stock}, nil
+}
+
+func (s *Server) modify(form map[string]string) (map[string]interface{}, error) {
+	vm, ok := s.servers[form["server_id"]]
+	if !ok {
+		return nil, apiFailure("Server not found")
+	}
+
+	if val, ok := form["vcpus"]; ok {
+		vm.Specs.VCPUs, _ = strconv.Atoi(val)
+	}
+	if val, ok := form["ram"]; ok {
+		vm.Specs.RAM, _ = strconv.Atoi(val)
+	}
+	if val, ok := form["storage"]; ok {
+		vm.Specs.STORAGE, _ = strconv.Atoi(val)
+	}
+	if val, ok := form["gpu_model"]; ok {
+		vm.Specs.GPU.Type = val
+	}
+	if val, ok := form["gpu_count"]; ok {
+		vm.Specs.GPU.Amount, _ = strconv.Atoi(val)
+	}
+
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (s *Server) deploy(form map[string]string) (map[string]interface{}, error) {
+	host, ok := s.stock[form["hostnode"]]
+	if !ok {
+		return nil, apiFailure("Hostnode not found")
+	}
+
+	gpuCount, _ := strconv.Atoi(form["gpu_count"])
+	gpus := host["specs"].(map[string]interface{})["gpu"].(map[string]interface{})
+	gpu, ok := gpus[form["gpu_model"]].(map[string]interface{})
+	if !ok {
+		return nil, apiFailure("GPU model not available on this hostnode")
+	}
+	available := toInt(gpu["amount"])
+	if available < gpuCount {
+		return nil, apiFailure("Not enough stock of the requested GPU on this hostnode")
+	}
+	gpu["amount"] = available - gpuCount
+
+	internal := parsePorts(form["internal_ports"])
+	external := parsePorts(form["external_ports"])
+	if len(internal) != len(external) {
+		return nil, apiFailure("internal_ports and external_ports must have the same length")
+	}
+
+	portForwards := map[string]string{}
+	for i := range internal {
+		portForwards[external[i]] = internal[i]
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("00000000-0000-4000-8000-%012d", s.nextID)
+	vcpus, _ := strconv.Atoi(form["vcpus"])
+	ram, _ := strconv.Atoi(form["ram"])
+	storage, _ := strconv.Atoi(form["storage"])
+
+	vm := &api.VirtualMachine{
+		Location:          form["hostnode"],
+		HostNode:          form["hostnode"],
+		Name:              form["name"],
+		OperatingSystem:   form["operating_system"],
+		PortForwards:      portForwards,
+		IP:                fmt.Sprintf("203.0.113.%d", s.nextID),
+		Type:              "virtualmachine",
+		Status:            "running",
+		TimestampCreation: time.Date(2024, 7, 21, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+	}
+	vm.Specs.GPU.Type = form["gpu_model"]
+	vm.Specs.GPU.Amount = gpuCount
+	vm.Specs.VCPUs = vcpus
+	vm.Specs.RAM = ram
+	vm.Specs.STORAGE = storage
+	s.servers[id] = vm
+
+	return map[string]interface{}{
+		"success":       true,
+		"server":        id,
+		"ip":            vm.IP,
+		"port_forwards": portForwards,
+		"cost": map[string]interface{}{
+			"compute_price": 0.4,
+			"storage_price": 0.001,
+			"total_price":   0.401,
+		},
+	}, nil
+}
+
+// parsePorts reads the `{22, 80}` form used by deploy/single.
+func parsePorts(raw string) []string {
+	raw = strings.Trim(raw, "{}")
+	var ports []string
+	for _, port := range strings.Split(raw, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func toInt(val interface{}) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
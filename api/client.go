@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -58,6 +60,17 @@ type DeployServerRequest struct {
 	ExternalPorts   []string `mapstructure:"external_ports"`
 }
 
+// Config returns the hardware requested by req.
+func (req DeployServerRequest) Config() ServerConfig {
+	return ServerConfig{
+		GPUModel: req.GPUModel,
+		GPUCount: req.GPUCount,
+		VCPUs:    req.VCPUs,
+		RAM:      req.RAM,
+		Storage:  req.Storage,
+	}
+}
+
 type ModifyServerRequest struct {
 	ServerId string  `mapstructure:"server_id"`
 	GPUModel *string `mapstructure:"gpu_model,omitempty"`
@@ -82,56 +95,106 @@ type DeployServerResponse struct {
 
 type ListStockResponse struct {
 	Response
-	HostNode map[string]struct {
-		Location struct {
-			City    string `json:"city"`
-			Country string `json:"country"`
-			Region  string `json:"region"`
-		} `json:"location"`
-		Networking struct {
-			Ports []int `json:"ports"`
-		} `json:"networking"`
-		Specs struct {
-			CPU struct {
-				Amount int `json:"amount"`
-				Name   string
-				Price  float64 `json:"price"`
-			} `json:"cpu"`
-			GPU map[string]struct {
-				Amount int `json:"amount"`
-				Name   string
-				Price  float64 `json:"price"`
-			} `json:"gpu"`
-			RAM struct {
-				Amount int     `json:"amount"`
-				Price  float64 `json:"price"`
-			} `json:"ram"`
-			Storage struct {
-				Amount int     `json:"amount"`
-				Price  float64 `json:"price"`
-			} `json:"storage"`
-		} `json:"specs"`
-	} `json:"hostnodes"`
+	HostNode map[string]HostNode `json:"hostnodes"`
 }
 
+// Every Client method returns an *APIError when the API reports a failure,
+// so callers never need to inspect Response.Success themselves.
 type Client struct {
 	BaseUrl  string
 	ApiKey   string
 	ApiToken string
 	Debug    bool
 	KeyPath  string
+
+	// HTTPClient is used to send every request, http.DefaultClient is
+	// used when it is nil.
+	HTTPClient *http.Client
+	// Timeout bounds a single attempt of a request, zero disables it.
+	Timeout time.Duration
+	// Retry controls how idempotent calls are retried.
+	Retry RetryPolicy
+}
+
+// Option configures optional behaviour of a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client send requests through httpClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.HTTPClient = httpClient
+	}
+}
+
+// WithTransport makes the client send requests through transport, e.g. to
+// add a proxy or to intercept requests in tests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(client *Client) {
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithTimeout sets the per-attempt request timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		client.Timeout = timeout
+	}
+}
+
+// WithRetry sets the retry policy used for idempotent calls.
+func WithRetry(policy RetryPolicy) Option {
+	return func(client *Client) {
+		client.Retry = policy
+	}
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient != nil {
+		return client.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (client *Client) do(ctx context.Context, method string, path string, params map[string]string, headers map[string]string, body []byte, idempotent bool) (*json.RawMessage, error) {
+	attempts := 1
+	if idempotent && client.Retry.MaxAttempts > 1 {
+		attempts = client.Retry.MaxAttempts
+	}
+
+	for attempt := 0; ; attempt++ {
+		raw, retry, err := client.attempt(ctx, method, path, params, headers, body)
+		if !retry || attempt+1 >= attempts {
+			return raw, err
+		}
+
+		if client.Debug {
+			log.Printf("retrying %v %v (attempt %v/%v)", method, path, attempt+2, attempts)
+		}
+
+		if err := sleep(ctx, client.Retry.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
 }
 
-func (client *Client) do(method string, path string, params map[string]string, headers map[string]string, body []byte) (*json.RawMessage, error) {
+// attempt sends a single request. The returned bool reports whether the
+// failure is transient and the request is worth retrying.
+func (client *Client) attempt(ctx context.Context, method string, path string, params map[string]string, headers map[string]string, body []byte) (*json.RawMessage, bool, error) {
 	query := url.Values{}
 	for key, elem := range params {
 		query.Add(key, elem)
 	}
 
+	if client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+
 	url := fmt.Sprintf("%v/%v?%v", client.BaseUrl, path, query.Encode())
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	for key, elem := range headers {
@@ -146,9 +209,9 @@ func (client *Client) do(method string, path string, params map[string]string, h
 		fmt.Println(string(reqDump))
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := client.httpClient().Do(req)
 	if err != nil {
-		return nil, err
+		return nil, isTransient(ctx, err), err
 	}
 	defer res.Body.Close()
 
@@ -160,23 +223,26 @@ func (client *Client) do(method string, path string, params map[string]string, h
 		fmt.Println(string(resDump))
 	}
 
-	bytes, _ := io.ReadAll(res.Body)
+	bytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, isTransient(ctx, err), err
+	}
 
 	// HACK: Workaround for API issue which causes endpoint to
 	// return an HTML Page with a 200 Status code
 	if strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
-		bytes, err := json.Marshal(Response{Success: false, Error: "api call failed"})
-		if err != nil {
-			return nil, err
-		}
-		msg := json.RawMessage(bytes)
-		return &msg, nil
+		return nil, true, newAPIError(path, res.StatusCode, "api call failed", bytes, true)
 	}
 
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+
 	var raw map[string]interface{}
 	err = json.Unmarshal(bytes, &raw)
 	if err != nil {
-		return nil, err
+		if res.StatusCode >= 400 {
+			return nil, retry, newAPIError(path, res.StatusCode, http.StatusText(res.StatusCode), bytes, false)
+		}
+		return nil, retry, err
 	}
 
 	// HACK: Some endpoints return a string boolean on the `success`` field
@@ -199,16 +265,21 @@ func (client *Client) do(method string, path string, params map[string]string, h
 		}
 	}
 
+	if success, _ := raw["success"].(bool); !success {
+		message, _ := raw["error"].(string)
+		return nil, retry, newAPIError(path, res.StatusCode, message, bytes, false)
+	}
+
 	bytes, err = json.Marshal(raw)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	msg := json.RawMessage(bytes)
-	return &msg, nil
+	return &msg, retry, nil
 }
 
-func (client *Client) get(path string, params map[string]string, auth bool) (*json.RawMessage, error) {
+func (client *Client) get(ctx context.Context, path string, params map[string]string, auth bool, idempotent bool) (*json.RawMessage, error) {
 	newParams := map[string]string{}
 
 	if auth {
@@ -223,10 +294,10 @@ func (client *Client) get(path string, params map[string]string, auth bool) (*js
 	headers := map[string]string{}
 	headers["User-Agent"] = fmt.Sprintf("td-stream/%v", CLIENT_VERSION)
 
-	return client.do(http.MethodGet, path, newParams, headers, nil)
+	return client.do(ctx, http.MethodGet, path, newParams, headers, nil, idempotent)
 }
 
-func (client *Client) post(path string, body map[string]string, auth bool) (*json.RawMessage, error) {
+func (client *Client) post(ctx context.Context, path string, body map[string]string, auth bool, idempotent bool) (*json.RawMessage, error) {
 	newBody := url.Values{}
 
 	if auth {
@@ -247,16 +318,18 @@ func (client *Client) post(path string, body map[string]string, auth bool) (*jso
 	correctedData := strings.ReplaceAll(encodedData, "+", "%20")
 
 	return client.do(
+		ctx,
 		http.MethodPost,
 		path,
 		nil,
 		headers,
 		[]byte(correctedData),
+		idempotent,
 	)
 }
 
-func (client *Client) ListServers() (*ListServersResponse, error) {
-	raw, err := client.post("list", nil, true)
+func (client *Client) ListServers(ctx context.Context) (*ListServersResponse, error) {
+	raw, err := client.post(ctx, "list", nil, true, true)
 	if err != nil {
 		return nil, err
 	}
@@ -269,8 +342,8 @@ func (client *Client) ListServers() (*ListServersResponse, error) {
 	return &res, nil
 }
 
-func (client *Client) StopServer(server string) (*Response, error) {
-	raw, err := client.get("stop/single", map[string]string{"server": server}, true)
+func (client *Client) StopServer(ctx context.Context, server string) (*Response, error) {
+	raw, err := client.get(ctx, "stop/single", map[string]string{"server": server}, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -283,8 +356,8 @@ func (client *Client) StopServer(server string) (*Response, error) {
 	return &res, nil
 }
 
-func (client *Client) StartServer(server string) (*Response, error) {
-	raw, err := client.get("start/single", map[string]string{"server": server}, true)
+func (client *Client) StartServer(ctx context.Context, server string) (*Response, error) {
+	raw, err := client.get(ctx, "start/single", map[string]string{"server": server}, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -297,8 +370,8 @@ func (client *Client) StartServer(server string) (*Response, error) {
 	return &res, nil
 }
 
-func (client *Client) DeleteServer(server string) (*Response, error) {
-	raw, err := client.get("delete/single", map[string]string{"server": server}, true)
+func (client *Client) DeleteServer(ctx context.Context, server string) (*Response, error) {
+	raw, err := client.get(ctx, "delete/single", map[string]string{"server": server}, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -311,8 +384,8 @@ func (client *Client) DeleteServer(server string) (*Response, error) {
 	return &res, nil
 }
 
-func (client *Client) GetServer(server string) (*GetServerResponse, error) {
-	raw, err := client.post("get/single", map[string]string{"server": server}, true)
+func (client *Client) GetServer(ctx context.Context, server string) (*GetServerResponse, error) {
+	raw, err := client.post(ctx, "get/single", map[string]string{"server": server}, true, true)
 	if err != nil {
 		return nil, err
 	}
@@ -325,7 +398,7 @@ func (client *Client) GetServer(server string) (*GetServerResponse, error) {
 	return &res, nil
 }
 
-func (client *Client) DeployServer(req DeployServerRequest) (*DeployServerResponse, error) {
+func (client *Client) DeployServer(ctx context.Context, req DeployServerRequest) (*DeployServerResponse, error) {
 	body := url.Values{} // Define 'body' here
 
 	var rawBody map[string]interface{}
@@ -375,11 +448,13 @@ func (client *Client) DeployServer(req DeployServerRequest) (*DeployServerRespon
 	correctedData := strings.ReplaceAll(encodedData, "+", "%20")
 
 	raw, err := client.do(
+		ctx,
 		http.MethodPost,
 		"deploy/single",
 		nil,
 		headers,
 		[]byte(correctedData),
+		false,
 	)
 	if err != nil {
 		return nil, err
@@ -393,8 +468,8 @@ func (client *Client) DeployServer(req DeployServerRequest) (*DeployServerRespon
 	return &res, nil
 }
 
-func (client *Client) GetBillingDetails() (*GetBillingDetailsResponse, error) {
-	raw, err := client.get("billing", nil, true)
+func (client *Client) GetBillingDetails(ctx context.Context) (*GetBillingDetailsResponse, error) {
+	raw, err := client.get(ctx, "billing", nil, true, true)
 	if err != nil {
 		return nil, err
 	}
@@ -407,12 +482,25 @@ func (client *Client) GetBillingDetails() (*GetBillingDetailsResponse, error) {
 	return &res, nil
 }
 
-func NewClient(baseUrl string, apiKey string, apiToken string, debug bool, keyPath string) *Client {
-	return &Client{baseUrl, apiKey, apiToken, debug, keyPath}
+func NewClient(baseUrl string, apiKey string, apiToken string, debug bool, keyPath string, opts ...Option) *Client {
+	client := &Client{
+		BaseUrl:  baseUrl,
+		ApiKey:   apiKey,
+		ApiToken: apiToken,
+		Debug:    debug,
+		KeyPath:  keyPath,
+		Retry:    DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
 }
 
-func (client *Client) RestartServer(server string) (*Response, error) {
-	raw, err := client.get("restart/single", map[string]string{"server": server}, true)
+func (client *Client) RestartServer(ctx context.Context, server string) (*Response, error) {
+	raw, err := client.get(ctx, "restart/single", map[string]string{"server": server}, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -425,8 +513,8 @@ func (client *Client) RestartServer(server string) (*Response, error) {
 	return &res, nil
 }
 
-func (client *Client) ListStock() (*ListStockResponse, error) {
-	raw, err := client.get("deploy/hostnodes", nil, false)
+func (client *Client) ListStock(ctx context.Context) (*ListStockResponse, error) {
+	raw, err := client.get(ctx, "deploy/hostnodes", nil, false, true)
 	if err != nil {
 		return nil, err
 	}
@@ -446,7 +534,7 @@ func (client *Client) ListStock() (*ListStockResponse, error) {
 	return &res, nil
 }
 
-func (client *Client) ModifyServer(req ModifyServerRequest) (*Response, error) {
+func (client *Client) ModifyServer(ctx context.Context, req ModifyServerRequest) (*Response, error) {
 	var rawBody map[string]interface{}
 	err := mapstructure.Decode(req, &rawBody)
 	if err != nil {
@@ -466,7 +554,7 @@ func (client *Client) ModifyServer(req ModifyServerRequest) (*Response, error) {
 		body[key] = fmt.Sprintf("%v", val)
 	}
 
-	raw, err := client.post("modify/single", body, true)
+	raw, err := client.post(ctx, "modify/single", body, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -479,8 +567,8 @@ func (client *Client) ModifyServer(req ModifyServerRequest) (*Response, error) {
 	return &res, nil
 }
 
-func (client *Client) GetServerStatus(server string) (*GetServerStatusResponse, error) {
-	raw, err := client.post("deploy/status", map[string]string{"server": server}, true)
+func (client *Client) GetServerStatus(ctx context.Context, server string) (*GetServerStatusResponse, error) {
+	raw, err := client.post(ctx, "deploy/status", map[string]string{"server": server}, true, true)
 	if err != nil {
 		return nil, err
 	}
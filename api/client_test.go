@@ -0,0 +1,275 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/api/apitest"
+)
+
+func deployTestServer(t *testing.T, client *api.Client) string {
+	t.Helper()
+
+	res, err := client.DeployServer(context.Background(), api.DeployServerRequest{
+		Name:            "test",
+		Password:        "secret",
+		HostNode:        "2a3c1e57-90a4-4c5e-8d3b-5f0e6a7b8c9d",
+		GPUModel:        "geforcertx4090-pcie-24gb",
+		GPUCount:        1,
+		VCPUs:           4,
+		RAM:             16,
+		Storage:         100,
+		OperatingSystem: "Ubuntu 22.04 LTS",
+		InternalPorts:   []string{"22", "47989"},
+		ExternalPorts:   []string{"20001", "20002"},
+	})
+	if err != nil {
+		t.Fatalf("DeployServer: %v", err)
+	}
+	return res.Server
+}
+
+func TestServerLifecycle(t *testing.T) {
+	srv := apitest.NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+
+	id := deployTestServer(t, client)
+
+	list, err := client.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if !list.Success {
+		t.Errorf("ListServers: missing success key was not treated as success")
+	}
+	if _, ok := list.VirtualMachines[id]; !ok {
+		t.Errorf("ListServers: deployed server %v missing", id)
+	}
+
+	get, err := client.GetServer(ctx, id)
+	if err != nil {
+		t.Fatalf("GetServer: %v", err)
+	}
+	if get.VirtualMachines.PortForwards["20001"] != "22" {
+		t.Errorf("GetServer: port forwards = %v", get.VirtualMachines.PortForwards)
+	}
+
+	if _, err := client.StopServer(ctx, id); err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+	status, err := client.GetServerStatus(ctx, id)
+	if err != nil {
+		t.Fatalf("GetServerStatus: %v", err)
+	}
+	if status.Status != "stopped" {
+		t.Errorf("GetServerStatus = %q, want stopped", status.Status)
+	}
+
+	vcpus := 8
+	if _, err := client.ModifyServer(ctx, api.ModifyServerRequest{ServerId: id, VCPUs: &vcpus}); err != nil {
+		t.Fatalf("ModifyServer: %v", err)
+	}
+	if vm, _ := srv.VM(id); vm.Specs.VCPUs != 8 {
+		t.Errorf("ModifyServer: vcpus = %v, want 8", vm.Specs.VCPUs)
+	}
+
+	if _, err := client.DeleteServer(ctx, id); err != nil {
+		t.Fatalf("DeleteServer: %v", err)
+	}
+	if _, err := client.GetServer(ctx, id); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("GetServer after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListStockStringBoolean(t *testing.T) {
+	srv := apitest.NewServer(t)
+
+	res, err := srv.Client().ListStock(context.Background())
+	if err != nil {
+		t.Fatalf("ListStock: %v", err)
+	}
+	if !res.Success {
+		t.Errorf("ListStock: string boolean success was not parsed")
+	}
+
+	host, ok := res.HostNode["2a3c1e57-90a4-4c5e-8d3b-5f0e6a7b8c9d"]
+	if !ok {
+		t.Fatalf("ListStock: hostnode missing")
+	}
+	if gpu := host.Specs.GPU["geforcertx4090-pcie-24gb"]; gpu.Name != "geforcertx4090-pcie-24gb" || gpu.Amount != 4 || gpu.VRAM != 24 || !gpu.RTX {
+		t.Errorf("ListStock: gpu = %+v", gpu)
+	}
+	if host.Specs.CPU.Type != "AMD EPYC 75F3" {
+		t.Errorf("ListStock: cpu type = %q", host.Specs.CPU.Type)
+	}
+	if host.Location.DC.Tier != 3 || host.Location.ID == "" {
+		t.Errorf("ListStock: location = %+v", host.Location)
+	}
+	if !host.Status.Online || host.Status.Uptime != 0.998 {
+		t.Errorf("ListStock: status = %+v", host.Status)
+	}
+	if host.Networking.Send != 10000 {
+		t.Errorf("ListStock: networking send = %v", host.Networking.Send)
+	}
+
+	r, ok := host.Specs.Restriction(1)
+	if !ok || r.CPU != (api.Range{Min: 2, Max: 32}) || r.Storage.Max != 2000 {
+		t.Errorf("ListStock: restriction = %+v", r)
+	}
+}
+
+func TestGetBillingDetails(t *testing.T) {
+	srv := apitest.NewServer(t)
+
+	res, err := srv.Client().GetBillingDetails(context.Background())
+	if err != nil {
+		t.Fatalf("GetBillingDetails: %v", err)
+	}
+	if res.Balance != 42.5 {
+		t.Errorf("Balance = %v, want 42.5", res.Balance)
+	}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure apitest.Failure
+	}{
+		{"html", apitest.Failure{HTML: true}},
+		{"server error", apitest.Failure{Status: http.StatusBadGateway}},
+		{"connection reset", apitest.Failure{Reset: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer(t)
+			srv.FailNext("billing", tt.failure, tt.failure)
+
+			if _, err := srv.Client().GetBillingDetails(context.Background()); err != nil {
+				t.Fatalf("GetBillingDetails: %v", err)
+			}
+			if calls := srv.Calls("billing"); calls != 3 {
+				t.Errorf("calls = %v, want 3", calls)
+			}
+		})
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	srv := apitest.NewServer(t)
+	html := apitest.Failure{HTML: true}
+	srv.FailNext("billing", html, html, html)
+
+	_, err := srv.Client().GetBillingDetails(context.Background())
+	if !errors.Is(err, api.ErrMaintenance) {
+		t.Fatalf("err = %v, want ErrMaintenance", err)
+	}
+	if calls := srv.Calls("billing"); calls != 3 {
+		t.Errorf("calls = %v, want 3", calls)
+	}
+}
+
+func TestNoRetryForMutations(t *testing.T) {
+	srv := apitest.NewServer(t)
+	client := srv.Client()
+	id := deployTestServer(t, client)
+	srv.FailNext("restart/single", apitest.Failure{Status: http.StatusInternalServerError, Message: "boom"})
+
+	if _, err := client.RestartServer(context.Background(), id); err == nil {
+		t.Fatal("RestartServer: expected an error")
+	}
+	if calls := srv.Calls("restart/single"); calls != 1 {
+		t.Errorf("calls = %v, want 1", calls)
+	}
+}
+
+func TestAPIErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure apitest.Failure
+		want    error
+		kind    api.ErrorKind
+	}{
+		{"credentials", apitest.Failure{Message: "Invalid API key or token"}, api.ErrInvalidCredentials, api.KindInvalidCredentials},
+		{"stock", apitest.Failure{Message: "Not enough stock of the requested GPU"}, api.ErrOutOfStock, api.KindOutOfStock},
+		{"not found", apitest.Failure{Message: "Server not found"}, api.ErrNotFound, api.KindNotFound},
+		{"rate limited", apitest.Failure{Status: http.StatusTooManyRequests, Message: "slow down"}, api.ErrRateLimited, api.KindRateLimited},
+		{"maintenance", apitest.Failure{Message: "Service unavailable, try again later"}, api.ErrMaintenance, api.KindMaintenance},
+		{"hostnode unavailable", apitest.Failure{Message: "Hostnode unavailable"}, nil, api.KindUnknown},
+		{"unknown", apitest.Failure{Message: "something odd"}, nil, api.KindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer(t)
+			srv.FailNext("deploy/single", tt.failure)
+
+			_, err := srv.Client().DeployServer(context.Background(), api.DeployServerRequest{})
+
+			var apiErr *api.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if apiErr.Kind != tt.kind {
+				t.Errorf("Kind = %v, want %v", apiErr.Kind, tt.kind)
+			}
+			if apiErr.Endpoint != "deploy/single" {
+				t.Errorf("Endpoint = %q", apiErr.Endpoint)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	srv := apitest.NewServer(t)
+	client := api.NewClient(srv.URL, "wrong", "wrong", false, "")
+
+	if _, err := client.ListServers(context.Background()); !errors.Is(err, api.ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	srv := apitest.NewServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := srv.Client().ListServers(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if calls := srv.Calls("list"); calls != 0 {
+		t.Errorf("calls = %v, want 0", calls)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	srv := apitest.NewServer(t)
+
+	var seen int
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		seen++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := srv.Client(api.WithTransport(transport), api.WithTimeout(time.Second))
+	if _, err := client.ListServers(context.Background()); err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if seen != 1 {
+		t.Errorf("transport saw %v requests, want 1", seen)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind classifies why the API rejected a call.
+type ErrorKind int
+
+const (
+	KindUnknown ErrorKind = iota
+	KindInvalidCredentials
+	KindOutOfStock
+	KindNotFound
+	KindRateLimited
+	KindMaintenance
+)
+
+// Sentinel errors matched by APIError through errors.Is.
+var (
+	ErrInvalidCredentials = errors.New("invalid API credentials")
+	ErrOutOfStock         = errors.New("host out of stock")
+	ErrNotFound           = errors.New("not found")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrMaintenance        = errors.New("api unavailable")
+)
+
+func (kind ErrorKind) String() string {
+	switch kind {
+	case KindInvalidCredentials:
+		return "invalid credentials"
+	case KindOutOfStock:
+		return "out of stock"
+	case KindNotFound:
+		return "not found"
+	case KindRateLimited:
+		return "rate limited"
+	case KindMaintenance:
+		return "maintenance"
+	default:
+		return "unknown"
+	}
+}
+
+func (kind ErrorKind) sentinel() error {
+	switch kind {
+	case KindInvalidCredentials:
+		return ErrInvalidCredentials
+	case KindOutOfStock:
+		return ErrOutOfStock
+	case KindNotFound:
+		return ErrNotFound
+	case KindRateLimited:
+		return ErrRateLimited
+	case KindMaintenance:
+		return ErrMaintenance
+	default:
+		return nil
+	}
+}
+
+// APIError is returned by every Client method when the API answers with
+// `success` set to false or with its HTML error page.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Message    string
+	Body       []byte
+	Kind       ErrorKind
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.String()
+	}
+	return fmt.Sprintf("%v: %v (status %v)", e.Endpoint, msg, e.StatusCode)
+}
+
+// Is makes errors.Is(err, ErrNotFound) and friends match on the kind.
+func (e *APIError) Is(target error) bool {
+	sentinel := e.Kind.sentinel()
+	return sentinel != nil && target == sentinel
+}
+
+// Temporary reports whether the failure is likely to go away on its own,
+// like rate limiting, maintenance or a server error.
+func (e *APIError) Temporary() bool {
+	return e.Kind == KindRateLimited || e.Kind == KindMaintenance || e.StatusCode >= 500
+}
+
+func newAPIError(endpoint string, statusCode int, message string, body []byte, html bool) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Endpoint:   endpoint,
+		Message:    message,
+		Body:       body,
+		Kind:       classify(statusCode, message, html),
+	}
+}
+
+// classify guesses the kind of a failure from the status code and, as the
+// API mostly answers 200 with a free-form message, from the message text.
+func classify(statusCode int, message string, html bool) ErrorKind {
+	if html {
+		return KindMaintenance
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return KindInvalidCredentials
+	case http.StatusNotFound:
+		return KindNotFound
+	case http.StatusTooManyRequests:
+		return KindRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return KindMaintenance
+	}
+
+	msg := strings.ToLower(message)
+	switch {
+	case containsAny(msg, "api key", "api_key", "api token", "api_token", "unauthorized", "authenticat", "credential"):
+		return KindInvalidCredentials
+	case containsAny(msg, "rate limit", "too many"):
+		return KindRateLimited
+	case containsAny(msg, "maintenance", "service unavailable", "temporarily unavailable"):
+		return KindMaintenance
+	case containsAny(msg, "stock", "not enough", "insufficient", "no longer available"):
+		return KindOutOfStock
+	case containsAny(msg, "not found", "does not exist", "no such", "invalid server"):
+		return KindNotFound
+	}
+
+	return KindUnknown
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AllocatePorts picks a free external port of the hostnode for each of the
+// internal ports. An internal port is mapped to the same external number
+// when that one is free, otherwise to the lowest free port left.
+func (host HostNode) AllocatePorts(internal []int) ([]int, error) {
+	free := make(map[int]bool, len(host.Networking.Ports))
+	for _, port := range host.Networking.Ports {
+		free[port] = true
+	}
+
+	external := make([]int, len(internal))
+	for i, port := range internal {
+		if free[port] {
+			external[i] = port
+			delete(free, port)
+		}
+	}
+
+	remaining := make([]int, 0, len(free))
+	for port := range free {
+		remaining = append(remaining, port)
+	}
+	sort.Ints(remaining)
+
+	for i := range internal {
+		if external[i] != 0 {
+			continue
+		}
+		if len(remaining) == 0 {
+			return nil, fmt.Errorf("not enough free ports on the hostnode for %v internal ports: %w", len(internal), ErrOutOfStock)
+		}
+		external[i] = remaining[0]
+		remaining = remaining[1:]
+	}
+
+	return external, nil
+}
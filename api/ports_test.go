@@ -0,0 +1,24 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAllocatePorts(t *testing.T) {
+	host := testHostNode()
+	host.Networking.Ports = []int{20002, 20000, 22, 20001}
+
+	got, err := host.AllocatePorts([]int{80, 22, 443})
+	if err != nil {
+		t.Fatalf("AllocatePorts: %v", err)
+	}
+	if want := []int{20000, 22, 20001}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllocatePorts = %v, want %v", got, want)
+	}
+
+	if _, err := host.AllocatePorts([]int{1, 2, 3, 4, 5}); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("AllocatePorts with too few ports: err = %v, want ErrOutOfStock", err)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import "fmt"
+
+// HoursPerMonth turns hourly prices into monthly estimates.
+const HoursPerMonth = 730
+
+// ServerConfig is the hardware requested for a server.
+type ServerConfig struct {
+	GPUModel string `json:"gpu_model"`
+	GPUCount int    `json:"gpu_count"`
+	VCPUs    int    `json:"vcpus"`
+	RAM      int    `json:"ram"`
+	Storage  int    `json:"storage"`
+}
+
+// Quote is the hourly cost of a ServerConfig on a hostnode, broken down by
+// component.
+type Quote struct {
+	GPU     float64 `json:"gpu"`
+	CPU     float64 `json:"cpu"`
+	RAM     float64 `json:"ram"`
+	Storage float64 `json:"storage"`
+	Hourly  float64 `json:"hourly"`
+	Monthly float64 `json:"monthly"`
+}
+
+// Quote prices cfg with the unit prices of the hostnode. It does not check
+// that the hostnode can actually fit the configuration.
+func (host HostNode) Quote(cfg ServerConfig) (Quote, error) {
+	gpu, ok := host.Specs.GPU[cfg.GPUModel]
+	if !ok {
+		return Quote{}, fmt.Errorf("hostnode does not offer GPU model %v", cfg.GPUModel)
+	}
+
+	q := Quote{
+		GPU:     gpu.Price * float64(cfg.GPUCount),
+		CPU:     host.Specs.CPU.Price * float64(cfg.VCPUs),
+		RAM:     host.Specs.RAM.Price * float64(cfg.RAM),
+		Storage: host.Specs.Storage.Price * float64(cfg.Storage),
+	}
+	q.Hourly = q.GPU + q.CPU + q.RAM + q.Storage
+	q.Monthly = q.Hourly * HoursPerMonth
+
+	return q, nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHostNodeQuote(t *testing.T) {
+	host := HostNode{}
+	host.Specs.GPU = map[string]GPUSpec{"geforcertx4090-pcie-24gb": {Price: 0.37}}
+	host.Specs.CPU.Price = 0.003
+	host.Specs.RAM.Price = 0.002
+	host.Specs.Storage.Price = 0.00005
+
+	q, err := host.Quote(ServerConfig{GPUModel: "geforcertx4090-pcie-24gb", GPUCount: 2, VCPUs: 4, RAM: 16, Storage: 100})
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+
+	want := Quote{GPU: 0.74, CPU: 0.012, RAM: 0.032, Storage: 0.005, Hourly: 0.789, Monthly: 0.789 * HoursPerMonth}
+	for name, pair := range map[string][2]float64{
+		"gpu":     {q.GPU, want.GPU},
+		"cpu":     {q.CPU, want.CPU},
+		"ram":     {q.RAM, want.RAM},
+		"storage": {q.Storage, want.Storage},
+		"hourly":  {q.Hourly, want.Hourly},
+		"monthly": {q.Monthly, want.Monthly},
+	} {
+		if math.Abs(pair[0]-pair[1]) > 1e-9 {
+			t.Errorf("%v = %v, want %v", name, pair[0], pair[1])
+		}
+	}
+
+	if _, err := host.Quote(ServerConfig{GPUModel: "missing"}); err == nil {
+		t.Error("Quote: expected an error for a GPU model the hostnode does not offer")
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how idempotent calls are retried when the API
+// returns a 5xx, the HTML error page or the connection drops.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2
+	// disable retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, it doubles on
+	// every following attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between two attempts.
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// backoff returns the delay before retrying after the given attempt, using
+// exponential backoff with equal jitter.
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 0; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isTransient reports whether err is a network failure worth retrying. It
+// never retries once the caller's context is done.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
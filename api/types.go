@@ -1,5 +1,11 @@
 package api
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
 type VirtualMachine struct {
 	Cost            float32           `json:"cost"`
 	Location        string            `json:"location"`
@@ -27,3 +33,126 @@ type BillingDetails struct {
 	Balance            float32 `json:"balance"`
 	HourlySpendingRate float32 `json:"hourly_spending_rate"`
 }
+
+// HostNode is a machine offered on the marketplace, as returned by
+// deploy/hostnodes.
+type HostNode struct {
+	Location   HostNodeLocation   `json:"location"`
+	Networking HostNodeNetworking `json:"networking"`
+	Specs      HostNodeSpecs      `json:"specs"`
+	Status     HostNodeStatus     `json:"status"`
+}
+
+type HostNodeLocation struct {
+	ID      string     `json:"id"`
+	City    string     `json:"city"`
+	Country string     `json:"country"`
+	Region  string     `json:"region"`
+	DC      DataCenter `json:"dc"`
+}
+
+type DataCenter struct {
+	Name string `json:"name"`
+	Tier int    `json:"tier"`
+}
+
+type HostNodeNetworking struct {
+	// Ports lists the external ports still free on the hostnode.
+	Ports []int `json:"ports"`
+	// Send and Receive are the uplink and downlink speeds in Mbps.
+	Send    int `json:"send"`
+	Receive int `json:"receive"`
+}
+
+type HostNodeSpecs struct {
+	CPU          CPUSpec                `json:"cpu"`
+	GPU          map[string]GPUSpec     `json:"gpu"`
+	RAM          ResourceSpec           `json:"ram"`
+	Storage      ResourceSpec           `json:"storage"`
+	Restrictions map[string]Restriction `json:"restrictions"`
+}
+
+// CPUSpec holds the vCPUs left on a hostnode and their hourly unit price.
+type CPUSpec struct {
+	Amount int     `json:"amount"`
+	Price  float64 `json:"price"`
+	Type   string  `json:"type"`
+}
+
+// GPUSpec holds the GPUs of one model left on a hostnode. Name is the model
+// key of the hostnode's GPU map, filled in by ListStock.
+type GPUSpec struct {
+	Name   string  `json:"name,omitempty"`
+	Amount int     `json:"amount"`
+	Price  float64 `json:"price"`
+	VRAM   int     `json:"vram"`
+	RTX    bool    `json:"rtx"`
+	GTX    bool    `json:"gtx"`
+	PCIe   bool    `json:"pcie"`
+}
+
+// ResourceSpec holds the amount of RAM or storage (GB) left on a hostnode
+// and the hourly price per GB.
+type ResourceSpec struct {
+	Amount int     `json:"amount"`
+	Price  float64 `json:"price"`
+}
+
+// Restriction bounds the resources a single server may request.
+type Restriction struct {
+	CPU     Range `json:"cpu"`
+	RAM     Range `json:"ram"`
+	Storage Range `json:"storage"`
+}
+
+type Range struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func (r Range) Contains(value int) bool {
+	return value >= r.Min && (r.Max == 0 || value <= r.Max)
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%v-%v", r.Min, r.Max)
+}
+
+type HostNodeStatus struct {
+	Online   bool    `json:"online"`
+	Listed   bool    `json:"listed"`
+	Reserved bool    `json:"reserved"`
+	Uptime   float64 `json:"uptime"`
+	Report   string  `json:"report"`
+}
+
+// Restriction returns the resource bounds of the hostnode. Restrictions are
+// keyed by a decimal index such as "0"; the entry whose index equals the
+// GPU count is preferred, and the lowest index is used otherwise.
+func (specs HostNodeSpecs) Restriction(gpuCount int) (Restriction, bool) {
+	if r, ok := specs.Restrictions[strconv.Itoa(gpuCount)]; ok {
+		return r, true
+	}
+
+	keys := make([]string, 0, len(specs.Restrictions))
+	for key := range specs.Restrictions {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return Restriction{}, false
+	}
+	// Numeric keys sort by value, so "2" comes before "10"; any others
+	// come last.
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		switch {
+		case errA == nil && errB == nil:
+			return a < b
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return keys[i] < keys[j]
+	})
+	return specs.Restrictions[keys[0]], true
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every reason a configuration cannot be deployed on
+// a hostnode.
+type ValidationError struct {
+	HostNode   string
+	Violations []string
+	// OutOfStock is set when one of the violations is missing stock, so
+	// the error matches ErrOutOfStock.
+	OutOfStock bool
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("cannot deploy on hostnode %v:\n  - %v", e.HostNode, strings.Join(e.Violations, "\n  - "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return e.OutOfStock && target == ErrOutOfStock
+}
+
+func (e *ValidationError) add(outOfStock bool, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, fmt.Sprintf(format, args...))
+	e.OutOfStock = e.OutOfStock || outOfStock
+}
+
+// Validate checks that cfg, exposed on externalPorts, fits on the hostnode:
+// the node must be online, have the GPUs in stock, enough vCPUs, RAM and
+// storage within its restrictions, and the ports must be free. It returns a
+// *ValidationError or nil.
+func (host HostNode) Validate(id string, cfg ServerConfig, externalPorts []int) error {
+	e := &ValidationError{HostNode: id}
+
+	if !host.Status.Online {
+		e.add(true, "hostnode is offline")
+	}
+
+	gpu, ok := host.Specs.GPU[cfg.GPUModel]
+	switch {
+	case !ok:
+		models := make([]string, 0, len(host.Specs.GPU))
+		for model := range host.Specs.GPU {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		e.add(true, "GPU model %v is not offered, available models: %v", cfg.GPUModel, strings.Join(models, ", "))
+	case cfg.GPUCount < 1:
+		e.add(false, "gpu count must be at least 1, got %v", cfg.GPUCount)
+	case gpu.Amount < cfg.GPUCount:
+		e.add(true, "only %v %v available, requested %v", gpu.Amount, cfg.GPUModel, cfg.GPUCount)
+	}
+
+	if r, ok := host.Specs.Restriction(cfg.GPUCount); ok {
+		checkRange(e, "vcpus", cfg.VCPUs, r.CPU, "")
+		checkRange(e, "ram", cfg.RAM, r.RAM, "GB")
+		checkRange(e, "storage", cfg.Storage, r.Storage, "GB")
+	}
+
+	checkAvailable(e, "vCPUs", cfg.VCPUs, host.Specs.CPU.Amount, "")
+	checkAvailable(e, "RAM", cfg.RAM, host.Specs.RAM.Amount, "GB")
+	checkAvailable(e, "storage", cfg.Storage, host.Specs.Storage.Amount, "GB")
+
+	free := make(map[int]bool, len(host.Networking.Ports))
+	for _, port := range host.Networking.Ports {
+		free[port] = true
+	}
+	seen := map[int]bool{}
+	for _, port := range externalPorts {
+		switch {
+		case seen[port]:
+			e.add(false, "external port %v is requested twice", port)
+		case !free[port]:
+			e.add(false, "external port %v is not available on this hostnode", port)
+		}
+		seen[port] = true
+	}
+
+	if len(e.Violations) > 0 {
+		return e
+	}
+	return nil
+}
+
+func checkRange(e *ValidationError, name string, value int, r Range, unit string) {
+	if r.Min == 0 && r.Max == 0 {
+		return
+	}
+	if !r.Contains(value) {
+		e.add(false, "%v %v%v outside the allowed range %v%v", name, value, unit, r, unit)
+	}
+}
+
+func checkAvailable(e *ValidationError, name string, value, available int, unit string) {
+	if value > available {
+		e.add(true, "only %v%v %v available, requested %v%v", available, unit, name, value, unit)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testHostNode() HostNode {
+	var host HostNode
+	host.Status.Online = true
+	host.Networking.Ports = []int{20000, 20001, 20002}
+	host.Specs.GPU = map[string]GPUSpec{"geforcertx4090-pcie-24gb": {Amount: 2}}
+	host.Specs.CPU.Amount = 16
+	host.Specs.RAM.Amount = 64
+	host.Specs.Storage.Amount = 500
+	host.Specs.Restrictions = map[string]Restriction{
+		"0": {CPU: Range{2, 16}, RAM: Range{4, 64}, Storage: Range{20, 500}},
+	}
+	return host
+}
+
+func TestValidate(t *testing.T) {
+	valid := ServerConfig{GPUModel: "geforcertx4090-pcie-24gb", GPUCount: 1, VCPUs: 4, RAM: 16, Storage: 100}
+
+	tests := []struct {
+		name       string
+		mutate     func(*HostNode, *ServerConfig, *[]int)
+		want       string
+		outOfStock bool
+	}{
+		{"valid", func(*HostNode, *ServerConfig, *[]int) {}, "", false},
+		{"offline", func(h *HostNode, _ *ServerConfig, _ *[]int) { h.Status.Online = false }, "hostnode is offline", true},
+		{"unknown gpu", func(_ *HostNode, c *ServerConfig, _ *[]int) { c.GPUModel = "a100" }, "GPU model a100 is not offered, available models: geforcertx4090-pcie-24gb", true},
+		{"gpu stock", func(_ *HostNode, c *ServerConfig, _ *[]int) { c.GPUCount = 3 }, "only 2 geforcertx4090-pcie-24gb available, requested 3", true},
+		{"storage range", func(_ *HostNode, c *ServerConfig, _ *[]int) { c.Storage = 10 }, "storage 10GB outside the allowed range 20-500GB", false},
+		{"port", func(_ *HostNode, _ *ServerConfig, p *[]int) { *p = []int{22} }, "external port 22 is not available on this hostnode", false},
+		{"duplicate port", func(_ *HostNode, _ *ServerConfig, p *[]int) { *p = []int{20000, 20000} }, "external port 20000 is requested twice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, cfg, ports := testHostNode(), valid, []int{20000, 20001}
+			tt.mutate(&host, &cfg, &ports)
+
+			err := host.Validate("host", cfg, ports)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate = %v, want %q", err, tt.want)
+			}
+			if got := errors.Is(err, ErrOutOfStock); got != tt.outOfStock {
+				t.Errorf("errors.Is(err, ErrOutOfStock) = %v, want %v", got, tt.outOfStock)
+			}
+		})
+	}
+}
+
+func TestRestriction(t *testing.T) {
+	specs := HostNodeSpecs{Restrictions: map[string]Restriction{
+		"10":  {CPU: Range{10, 10}},
+		"2":   {CPU: Range{2, 2}},
+		"gpu": {CPU: Range{99, 99}},
+		"3":   {CPU: Range{3, 3}},
+	}}
+
+	for gpuCount, want := range map[int]int{3: 3, 4: 2, 10: 10} {
+		r, ok := specs.Restriction(gpuCount)
+		if !ok || r.CPU.Min != want {
+			t.Errorf("Restriction(%v) = %+v, %v, want the entry of %v", gpuCount, r, ok, want)
+		}
+	}
+
+	if _, ok := (HostNodeSpecs{}).Restriction(1); ok {
+		t.Error("Restriction without restrictions reported one")
+	}
+}
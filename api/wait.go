@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StatusDeleted is the pseudo status WaitForStatus accepts to wait for a
+// server to disappear.
+const StatusDeleted = "deleted"
+
+// WaitOptions controls how Poll checks a condition.
+type WaitOptions struct {
+	// Timeout bounds the whole wait, 0 waits until ctx is done.
+	Timeout time.Duration
+	// Interval is the first delay between checks. It grows by half on every
+	// check up to MaxInterval.
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Progress, if set, is called after every check with the last observed
+	// state, or the temporary error the check failed with, and the time
+	// spent waiting so far.
+	Progress func(state string, elapsed time.Duration)
+}
+
+// DefaultWaitOptions checks every 2s at first and every 15s at most, for up
+// to 10 minutes.
+var DefaultWaitOptions = WaitOptions{
+	Timeout:     10 * time.Minute,
+	Interval:    2 * time.Second,
+	MaxInterval: 15 * time.Second,
+}
+
+// WaitError is returned when the wait times out before the target is
+// reached. It matches context.DeadlineExceeded.
+type WaitError struct {
+	Target  string
+	State   string
+	Elapsed time.Duration
+}
+
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("timed out after %v waiting for %v, last state %q", e.Elapsed.Round(time.Second), e.Target, e.State)
+}
+
+func (e *WaitError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// CheckFunc reports the current state and whether the wait is over.
+type CheckFunc func(ctx context.Context) (state string, done bool, err error)
+
+// Poll calls check until it reports done, returns an error or the timeout
+// expires.
+func Poll(ctx context.Context, target string, opts WaitOptions, check CheckFunc) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWaitOptions.Interval
+	}
+	if opts.MaxInterval < opts.Interval {
+		opts.MaxInterval = opts.Interval
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	delay := opts.Interval
+	var state string
+	for {
+		current, done, err := check(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// The wait ran out during the check; its error says nothing
+			// about the server, so the last state is kept.
+			return &WaitError{Target: target, State: state, Elapsed: time.Since(start)}
+		}
+		state = current
+
+		// A passing outage should not end a wait that may take minutes; it
+		// is reported as the state instead.
+		var apiErr *APIError
+		retry := err != nil && ((errors.As(err, &apiErr) && apiErr.Temporary()) || isTransient(ctx, err))
+		if retry && !done {
+			state = err.Error()
+		}
+		if opts.Progress != nil {
+			opts.Progress(state, time.Since(start))
+		}
+		if done {
+			return nil
+		}
+		if err != nil && !retry {
+			return err
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return &WaitError{Target: target, State: state, Elapsed: time.Since(start)}
+			}
+			return err
+		}
+		delay = min(delay*3/2, opts.MaxInterval)
+	}
+}
+
+// WaitForStatus polls GetServerStatus until the server reports status, or
+// until it is gone when status is StatusDeleted.
+func (c *Client) WaitForStatus(ctx context.Context, serverId, status string, opts WaitOptions) error {
+	return Poll(ctx, status, opts, func(ctx context.Context) (string, bool, error) {
+		res, err := c.GetServerStatus(ctx, serverId)
+		if errors.Is(err, ErrNotFound) {
+			return StatusDeleted, status == StatusDeleted, err
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return res.Status, res.Status == status, nil
+	})
+}
@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/api/apitest"
+)
+
+func TestWaitForStatus(t *testing.T) {
+	srv := apitest.NewServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	id := deployTestServer(t, client)
+
+	var states []string
+	opts := api.WaitOptions{
+		Timeout:  time.Second,
+		Interval: time.Millisecond,
+		Progress: func(state string, _ time.Duration) { states = append(states, state) },
+	}
+
+	if err := client.WaitForStatus(ctx, id, "running", opts); err != nil {
+		t.Fatalf("WaitForStatus running: %v", err)
+	}
+	if len(states) != 1 || states[0] != "running" {
+		t.Errorf("progress = %v, want [running]", states)
+	}
+
+	if _, err := client.DeleteServer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WaitForStatus(ctx, id, api.StatusDeleted, opts); err != nil {
+		t.Fatalf("WaitForStatus deleted: %v", err)
+	}
+	if err := client.WaitForStatus(ctx, id, "running", opts); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("WaitForStatus on a deleted server: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestWaitForStatusTimeout(t *testing.T) {
+	srv := apitest.NewServer(t)
+	client := srv.Client()
+	id := deployTestServer(t, client)
+
+	opts := api.WaitOptions{Timeout: 50 * time.Millisecond, Interval: 5 * time.Millisecond}
+	err := client.WaitForStatus(context.Background(), id, "stopped", opts)
+
+	var waitErr *api.WaitError
+	if !errors.As(err, &waitErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want *WaitError matching DeadlineExceeded", err)
+	}
+	if waitErr.State != "running" {
+		t.Errorf("State = %q, want running", waitErr.State)
+	}
+	if calls := srv.Calls("deploy/status"); calls < 2 {
+		t.Errorf("polled %v times, want several", calls)
+	}
+}
+
+func TestPollTemporaryErrors(t *testing.T) {
+	var states []string
+	opts := api.WaitOptions{Timeout: time.Second, Interval: time.Millisecond, Progress: func(state string, elapsed time.Duration) {
+		states = append(states, state)
+	}}
+
+	failures := []error{
+		&api.APIError{StatusCode: 503, Kind: api.KindMaintenance},
+		&api.APIError{StatusCode: 429, Kind: api.KindRateLimited},
+		&api.APIError{StatusCode: 500},
+	}
+	calls := 0
+	err := api.Poll(context.Background(), "running", opts, func(ctx context.Context) (string, bool, error) {
+		calls++
+		if calls <= len(failures) {
+			return "", false, failures[calls-1]
+		}
+		return "running", true, nil
+	})
+	if err != nil {
+		t.Fatalf("Poll through temporary errors: %v", err)
+	}
+	if calls != len(failures)+1 {
+		t.Errorf("checked %v times, want %v", calls, len(failures)+1)
+	}
+	if len(states) != len(failures)+1 || states[0] != failures[0].Error() || states[len(failures)] != "running" {
+		t.Errorf("progress = %q, want the errors and then running", states)
+	}
+
+	calls = 0
+	permanent := &api.APIError{StatusCode: 200, Kind: api.KindInvalidCredentials}
+	err = api.Poll(context.Background(), "running", opts, func(ctx context.Context) (string, bool, error) {
+		calls++
+		return "", false, permanent
+	})
+	if !errors.Is(err, api.ErrInvalidCredentials) || calls != 1 {
+		t.Errorf("Poll on a permanent error: err = %v after %v checks", err, calls)
+	}
+}
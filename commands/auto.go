@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/spf13/cobra"
+)
+
+// candidate is a hostnode that can take a deploy, with the external ports
+// the deploy would use on it.
+type candidate struct {
+	quoteItem
+	Uptime   float64 `json:"uptime"`
+	External []int   `json:"external_ports"`
+	// Preferred is set when the hostnode is in the --prefer-region.
+	Preferred bool `json:"preferred"`
+}
+
+func asCandidate(item interface{}) candidate {
+	return item.(candidate)
+}
+
+var candidateColumns = []column{
+	{Name: "HostNode ID", Value: func(i interface{}) interface{} { return asCandidate(i).HostNode }},
+	{Name: "Location", Value: func(i interface{}) interface{} { return asCandidate(i).Location }},
+	{
+		Name:  "Hourly",
+		Value: func(i interface{}) interface{} { return price(asCandidate(i).Hourly) },
+		Sort:  func(i interface{}) interface{} { return asCandidate(i).Hourly },
+	},
+	{
+		Name:  "Monthly",
+		Value: func(i interface{}) interface{} { return fmt.Sprintf("$%.2f", asCandidate(i).Monthly) },
+		Sort:  func(i interface{}) interface{} { return asCandidate(i).Monthly },
+	},
+	{
+		Name:  "Uptime",
+		Value: func(i interface{}) interface{} { return fmt.Sprintf("%.1f%%", asCandidate(i).Uptime*100) },
+		Sort:  func(i interface{}) interface{} { return asCandidate(i).Uptime },
+	},
+	{Name: "Preferred", Value: func(i interface{}) interface{} { return asCandidate(i).Preferred }},
+}
+
+// rankCandidates returns every hostnode that passes validation for cfg,
+// or every hostnode that has a price for it when validate is false,
+// cheapest first. Equal prices are ordered by uptime and then by whether the
+// hostnode is in the preferred region. When external is nil the ports are
+// allocated on each hostnode.
+func rankCandidates(stock map[string]api.HostNode, cfg api.ServerConfig, internal, external []int, prefer string, validate bool) []candidate {
+	var candidates []candidate
+	for id, host := range stock {
+		ports := external
+		if ports == nil {
+			var err error
+			if ports, err = host.AllocatePorts(internal); err != nil {
+				continue
+			}
+		}
+
+		if validate && host.Validate(id, cfg, ports) != nil {
+			continue
+		}
+
+		item, err := newQuoteItem(id, host, cfg)
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, candidate{
+			quoteItem: item,
+			Uptime:    host.Status.Uptime,
+			External:  ports,
+			Preferred: prefer != "" && matchRegion(prefer, host.Location.Region, host.Location.Country),
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		// Compare prices at the precision they are shown with so float
+		// noise does not hide a tie.
+		if pa, pb := math.Round(a.Hourly*1e4), math.Round(b.Hourly*1e4); pa != pb {
+			return pa < pb
+		}
+		if a.Uptime != b.Uptime {
+			return a.Uptime > b.Uptime
+		}
+		if a.Preferred != b.Preferred {
+			return a.Preferred
+		}
+		return a.HostNode < b.HostNode
+	})
+
+	return candidates
+}
+
+// deployAuto deploys req on the best ranked hostnode, moving on to the next
+// one when the marketplace reports it out of stock. It returns the ID of the
+// new server, or an empty ID for a dry run.
+func deployAuto(cmd *cobra.Command, req api.DeployServerRequest, internal, external []int, dryRun, skipValidation bool) (string, error) {
+	flags := cmd.Flags()
+
+	prefer, err := flags.GetString("prefer-region")
+	if err != nil {
+		return "", err
+	}
+
+	location, err := flags.GetString("location")
+	if err != nil {
+		return "", err
+	}
+
+	count, err := flags.GetInt("candidates")
+	if err != nil {
+		return "", err
+	}
+
+	stock, err := client.ListStock(cmd.Context())
+	if err != nil {
+		return "", err
+	}
+
+	hosts := stock.HostNode
+	if location != "" {
+		hosts = map[string]api.HostNode{}
+		for id, host := range stock.HostNode {
+			if l := host.Location; matchRegion(location, l.Region, l.Country) || containsFold(l.City, location) {
+				hosts[id] = host
+			}
+		}
+	}
+
+	cfg := req.Config()
+	candidates := rankCandidates(hosts, cfg, internal, external, prefer, !skipValidation)
+	if len(candidates) == 0 {
+		where := ""
+		if location != "" {
+			where = " in " + location
+		}
+		return "", fmt.Errorf("no hostnode%v can fit %vx %v with %v vCPUs, %vGB RAM and %vGB storage: %w",
+			where, cfg.GPUCount, cfg.GPUModel, cfg.VCPUs, cfg.RAM, cfg.Storage, api.ErrOutOfStock)
+	}
+
+	top := view{Columns: candidateColumns}
+	for _, c := range candidates[:min(count, len(candidates))] {
+		top.Items = append(top.Items, c)
+	}
+
+	if dryRun {
+		return "", render(cmd, top)
+	}
+	renderTable(cmd.ErrOrStderr(), top, top.Columns)
+
+	for _, c := range candidates {
+		req.HostNode = c.HostNode
+		req.ExternalPorts = portStrings(c.External)
+
+		res, err := client.DeployServer(cmd.Context(), req)
+		if errors.Is(err, api.ErrOutOfStock) {
+			log.Printf("hostnode %v: %v, trying the next candidate", c.HostNode, err)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		log.Printf("deployed on hostnode %v (%v, %v/h)", c.HostNode, c.Location, price(c.Hourly))
+		if external == nil {
+			recordPorts(res.Server, internal, c.External)
+		}
+
+		return res.Server, nil
+	}
+
+	return "", fmt.Errorf("every candidate hostnode ran out of stock: %w", api.ErrOutOfStock)
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/api/apitest"
+	"github.com/raefon/td-stream/state"
+)
+
+func autoTestHost(gpuPrice, uptime float64, country string) api.HostNode {
+	var host api.HostNode
+	host.Status.Online = true
+	host.Status.Uptime = uptime
+	host.Location.Country = country
+	host.Networking.Ports = []int{20000, 20001}
+	host.Specs.GPU = map[string]api.GPUSpec{"geforcertx4090-pcie-24gb": {Name: "geforcertx4090-pcie-24gb", Amount: 1, Price: gpuPrice}}
+	host.Specs.CPU.Amount = 8
+	host.Specs.RAM.Amount = 32
+	host.Specs.Storage.Amount = 200
+	return host
+}
+
+func TestRankCandidates(t *testing.T) {
+	full := autoTestHost(0.1, 1, "Germany")
+	full.Specs.GPU["geforcertx4090-pcie-24gb"] = api.GPUSpec{Name: "geforcertx4090-pcie-24gb"}
+
+	stock := map[string]api.HostNode{
+		"expensive": autoTestHost(0.5, 1, "Germany"),
+		"flaky":     autoTestHost(0.3, 0.9, "Germany"),
+		"remote":    autoTestHost(0.3, 0.99, "Japan"),
+		"near":      autoTestHost(0.3, 0.99, "Germany"),
+		"full":      full,
+	}
+	cfg := api.ServerConfig{GPUModel: "geforcertx4090-pcie-24gb", GPUCount: 1, VCPUs: 2, RAM: 4, Storage: 20}
+
+	candidates := rankCandidates(stock, cfg, []int{22}, nil, "europe", true)
+
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.HostNode)
+	}
+	if want := "near remote flaky expensive"; strings.Join(got, " ") != want {
+		t.Errorf("rankCandidates = %v, want %v", got, want)
+	}
+	if ports := candidates[0].External; len(ports) != 1 || ports[0] != 20000 {
+		t.Errorf("allocated ports = %v", ports)
+	}
+
+	// Without validation the full hostnode is a candidate too.
+	candidates = rankCandidates(stock, cfg, []int{22}, nil, "europe", false)
+	if len(candidates) != 5 || candidates[0].HostNode != "full" {
+		t.Errorf("rankCandidates without validation = %+v", candidates)
+	}
+}
+
+func TestServersDeployAuto(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--auto", "--internal_ports", "22,47989")
+	if err != nil {
+		t.Fatalf("servers deploy --auto: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	vm, ok := srv.VM(lines[len(lines)-1])
+	if !ok {
+		t.Fatalf("servers deploy --auto: server not created:\n%v", out)
+	}
+	if vm.HostNode != testHostNode {
+		t.Errorf("hostnode = %v, want %v", vm.HostNode, testHostNode)
+	}
+	if !strings.Contains(out, testHostNode) {
+		t.Errorf("candidates not shown:\n%v", out)
+	}
+
+	var mapping []portMapping
+	if err := state.Load(portsStateName(lines[len(lines)-1]), &mapping); err != nil || len(mapping) != 2 || mapping[1].Internal != 47989 {
+		t.Errorf("recorded ports = %+v, %v", mapping, err)
+	}
+
+	if _, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--auto", "--hostnode", testHostNode); err == nil {
+		t.Error("--auto with --hostnode: expected an error")
+	}
+
+	_, err = runCommand(t, srv, "servers", "deploy", "new", "secret", "--auto", "--location", "Antarctica")
+	if !errors.Is(err, api.ErrOutOfStock) || !strings.Contains(err.Error(), "in Antarctica") {
+		t.Errorf("--location without hostnodes: err = %v", err)
+	}
+	if _, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--hostnode", testHostNode, "--location", "Germany"); err == nil {
+		t.Error("--location without --auto: expected an error")
+	}
+}
+
+func TestServersDeployAutoFallback(t *testing.T) {
+	srv := newTestServer(t)
+	srv.FailNext("deploy/single", apitest.Failure{Message: "Not enough stock of the requested GPU on this hostnode"})
+
+	_, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--auto")
+	if !errors.Is(err, api.ErrOutOfStock) {
+		t.Fatalf("err = %v, want ErrOutOfStock", err)
+	}
+	if calls := srv.Calls("deploy/single"); calls != 1 {
+		t.Errorf("deploy/single calls = %v, want 1", calls)
+	}
+
+	srv.SetGPUStock(testHostNode, "geforcertx4090-pcie-24gb", 0)
+	if _, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--auto"); exitCode(err) != exitOutOfStock {
+		t.Errorf("no candidates: exitCode = %v (%v), want %v", exitCode(err), err, exitOutOfStock)
+	}
+}
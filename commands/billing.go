@@ -1,9 +1,7 @@
 package commands
 
 import (
-	"errors"
-	"fmt"
-
+	"github.com/raefon/td-stream/api"
 	"github.com/spf13/cobra"
 )
 
@@ -12,20 +10,23 @@ var (
 		Use:   "billing",
 		Short: "Manage billing",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			res, err := client.GetBillingDetails()
+			res, err := client.GetBillingDetails(cmd.Context())
 			if err != nil {
 				return err
 			}
 
-			if !res.Success {
-				return errors.New(res.Error)
-			}
-
-			fmt.Printf(`Balance: %v
-Hourly Spending Rate: %v`,
-				res.Balance,
-				res.HourlySpendingRate)
-			return nil
+			return render(cmd, view{
+				Columns: []column{
+					{Name: "Balance", Value: func(i interface{}) interface{} {
+						return i.(api.BillingDetails).Balance
+					}},
+					{Name: "Hourly Spending Rate", Value: func(i interface{}) interface{} {
+						return i.(api.BillingDetails).HourlySpendingRate
+					}},
+				},
+				Items:    []interface{}{res.BillingDetails},
+				Vertical: true,
+			})
 		},
 	}
 )
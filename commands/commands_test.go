@@ -0,0 +1,439 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/api/apitest"
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	testHostNode = "2a3c1e57-90a4-4c5e-8d3b-5f0e6a7b8c9d"
+	testServerID = "11111111-2222-4333-8444-555555555555"
+)
+
+// newTestServer starts a fake marketplace holding one running server.
+func newTestServer(t *testing.T) *apitest.Server {
+	t.Helper()
+
+	srv := apitest.NewServer(t)
+	vm := api.VirtualMachine{
+		Name:            "gaming",
+		HostNode:        testHostNode,
+		IP:              "203.0.113.10",
+		OperatingSystem: "Ubuntu 22.04 LTS",
+		PortForwards:    map[string]string{"20022": "22", "20089": "47989"},
+		Status:          "running",
+	}
+	vm.Specs.VCPUs = 4
+	vm.Specs.RAM = 16
+	vm.Specs.STORAGE = 100
+	vm.Specs.GPU.Type = "geforcertx4090-pcie-24gb"
+	vm.Specs.GPU.Amount = 1
+	srv.AddServer(testServerID, vm)
+
+	return srv
+}
+
+// runCommand executes the root command against srv and returns its output.
+func runCommand(t *testing.T, srv *apitest.Server, args ...string) (string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "tensordock.yml")
+	contents := fmt.Sprintf("serviceUrl: %v\napiKey: %v\napiToken: %v\nretries: 1\n", srv.URL, apitest.APIKey, apitest.APIToken)
+	if err := os.WriteFile(cfg, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", configHome(t))
+
+	viper.Reset()
+	resetFlags(rootCmd)
+	bindFlags()
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(append([]string{"--config", cfg}, args...))
+	t.Cleanup(func() {
+		resetFlags(rootCmd)
+		sessions.Close()
+	})
+
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+var configHomes = map[*testing.T]string{}
+
+// configHome returns a config directory that, unlike HOME, is shared by all
+// the runCommand calls of a test so local state survives between them.
+func configHome(t *testing.T) string {
+	t.Helper()
+
+	if dir, ok := configHomes[t]; ok {
+		return dir
+	}
+	dir := t.TempDir()
+	configHomes[t] = dir
+	t.Cleanup(func() { delete(configHomes, t) })
+	return dir
+}
+
+// resetFlags restores every flag to its default so tests do not leak
+// state into each other through the shared command tree.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+// fakeSSH writes an ssh stand-in that records its arguments and returns its
+// path together with the path of the log.
+func fakeSSH(t *testing.T) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "ssh.log")
+	bin := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %v\n", logPath)
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, logPath
+}
+
+// newSSHServer starts an SSH server running handler and points the test
+// server at it.
+func newSSHServer(t *testing.T, srv *apitest.Server, handler remotetest.Handler) *remotetest.Server {
+	t.Helper()
+
+	sshSrv := remotetest.NewServer(t, handler)
+	vm, _ := srv.VM(testServerID)
+	vm.IP = "127.0.0.1"
+	vm.PortForwards = map[string]string{sshSrv.Port(): "22"}
+	srv.AddServer(testServerID, vm)
+	return sshSrv
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestServersList(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "list")
+	if err != nil {
+		t.Fatalf("servers list: %v", err)
+	}
+	if !strings.Contains(out, testServerID) || !strings.Contains(out, "gaming") {
+		t.Errorf("servers list output missing server:\n%v", out)
+	}
+}
+
+func TestServersInfo(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "info", testServerID)
+	if err != nil {
+		t.Fatalf("servers info: %v", err)
+	}
+	if !strings.Contains(out, "203.0.113.10") {
+		t.Errorf("servers info output missing IP:\n%v", out)
+	}
+}
+
+func TestServersInfoNotFound(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := runCommand(t, srv, "servers", "info", "missing")
+	if !errors.Is(err, api.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if code := exitCode(err); code != exitNotFound {
+		t.Errorf("exitCode = %v, want %v", code, exitNotFound)
+	}
+}
+
+func TestServersLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+
+	steps := []struct {
+		args   []string
+		status string
+	}{
+		{[]string{"servers", "stop", testServerID}, "stopped"},
+		{[]string{"servers", "start", testServerID}, "running"},
+		{[]string{"servers", "restart", testServerID}, "running"},
+	}
+
+	for _, step := range steps {
+		if _, err := runCommand(t, srv, step.args...); err != nil {
+			t.Fatalf("%v: %v", step.args, err)
+		}
+		if vm, _ := srv.VM(testServerID); vm.Status != step.status {
+			t.Errorf("%v: status = %q, want %q", step.args, vm.Status, step.status)
+		}
+	}
+
+	out, err := runCommand(t, srv, "servers", "status", testServerID)
+	if err != nil {
+		t.Fatalf("servers status: %v", err)
+	}
+	if strings.TrimSpace(out) != "running" {
+		t.Errorf("servers status = %q, want running", out)
+	}
+
+	if _, err := runCommand(t, srv, "servers", "delete", testServerID); err != nil {
+		t.Fatalf("servers delete: %v", err)
+	}
+	if _, ok := srv.VM(testServerID); ok {
+		t.Error("servers delete: server still exists")
+	}
+}
+
+func TestServersModify(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := runCommand(t, srv, "servers", "modify", testServerID, "--vcpus", "8", "--ram", "32"); err != nil {
+		t.Fatalf("servers modify: %v", err)
+	}
+
+	vm, _ := srv.VM(testServerID)
+	if vm.Specs.VCPUs != 8 || vm.Specs.RAM != 32 {
+		t.Errorf("specs = %+v, want 8 vcpus and 32GB", vm.Specs)
+	}
+	if vm.Specs.STORAGE != 100 {
+		t.Errorf("storage = %v, unchanged flag should not be sent", vm.Specs.STORAGE)
+	}
+}
+
+func TestServersDeploy(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "deploy", "new", "secret",
+		"--hostnode", testHostNode,
+		"--internal_ports", "22,47989",
+		"--external_ports", "20001,20002",
+	)
+	if err != nil {
+		t.Fatalf("servers deploy: %v", err)
+	}
+
+	id := strings.TrimSpace(out)
+	vm, ok := srv.VM(id)
+	if !ok {
+		t.Fatalf("servers deploy: server %q not created", id)
+	}
+	if vm.PortForwards["20001"] != "22" {
+		t.Errorf("port forwards = %v", vm.PortForwards)
+	}
+}
+
+func TestServersDeployOutOfStock(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetGPUStock(testHostNode, "geforcertx4090-pcie-24gb", 0)
+
+	_, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--hostnode", testHostNode)
+	if code := exitCode(err); code != exitOutOfStock {
+		t.Fatalf("exitCode = %v (%v), want %v", code, err, exitOutOfStock)
+	}
+}
+
+func TestServersDeployValidation(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := runCommand(t, srv, "servers", "deploy", "new", "secret",
+		"--hostnode", testHostNode,
+		"--gpuCount", "5",
+		"--vcpus", "64",
+		"--ram", "2",
+		"--external_ports", "20001,47600",
+	)
+	if err == nil {
+		t.Fatal("servers deploy: expected a validation error")
+	}
+	for _, want := range []string{
+		"only 4 geforcertx4090-pcie-24gb available, requested 5",
+		"vcpus 64 outside the allowed range 2-32",
+		"ram 2GB outside the allowed range 4-128GB",
+		"only 32 vCPUs available, requested 64",
+		"external port 47600 is not available",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+	if srv.Calls("deploy/single") != 0 {
+		t.Error("invalid deploy reached deploy/single")
+	}
+
+	if _, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--hostnode", "missing"); exitCode(err) != exitOutOfStock {
+		t.Errorf("unknown hostnode: exitCode = %v (%v), want %v", exitCode(err), err, exitOutOfStock)
+	}
+}
+
+func TestServersDeploySkipValidation(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--hostnode", testHostNode, "--skip-validation"); err != nil {
+		t.Fatalf("servers deploy --skip-validation: %v", err)
+	}
+	if srv.Calls("deploy/hostnodes") != 0 {
+		t.Error("--skip-validation still fetched the stock")
+	}
+}
+
+func TestStockList(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "stock", "list")
+	if err != nil {
+		t.Fatalf("stock list: %v", err)
+	}
+	if !strings.Contains(out, "geforcertx4090-pcie-24gb") {
+		t.Errorf("stock list output missing in-stock GPU:\n%v", out)
+	}
+	if strings.Contains(out, "geforcertx3060-pcie-12gb") {
+		t.Errorf("stock list output contains out-of-stock GPU:\n%v", out)
+	}
+
+	out, err = runCommand(t, srv, "stock", "list", "--all")
+	if err != nil {
+		t.Fatalf("stock list --all: %v", err)
+	}
+	if !strings.Contains(out, "geforcertx3060-pcie-12gb") {
+		t.Errorf("stock list --all output missing out-of-stock GPU:\n%v", out)
+	}
+}
+
+func TestStockListWide(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "stock", "list", "-o", "wide")
+	if err != nil {
+		t.Fatalf("stock list: %v", err)
+	}
+	for _, want := range []string{"24GB", "AMD EPYC 75F3", "Idaho Falls", "2-32", "99.8%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stock list -o wide output missing %q:\n%v", want, out)
+		}
+	}
+}
+
+func TestBilling(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "billing")
+	if err != nil {
+		t.Fatalf("billing: %v", err)
+	}
+	if !strings.Contains(out, "Balance") || !strings.Contains(out, "42.5") {
+		t.Errorf("billing output:\n%v", out)
+	}
+}
+
+func TestAPIMaintenance(t *testing.T) {
+	srv := newTestServer(t)
+	srv.FailNext("billing", apitest.Failure{HTML: true})
+
+	_, err := runCommand(t, srv, "billing")
+	if code := exitCode(err); code != exitMaintenance {
+		t.Fatalf("exitCode = %v (%v), want %v", code, err, exitMaintenance)
+	}
+}
+
+func TestSSHCommands(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"wolf", "logs", testServerID}, []string{"docker logs wolf-wolf-1"}},
+		{[]string{"wolf", "install", testServerID}, []string{"cat > '/home/user/docker-compose.nvidia.yml'", "docker-nvidia-start.sh /home/user/docker-compose.nvidia.yml"}},
+		{[]string{"nvidia", "install", testServerID}, []string{"nvidia-driver-535"}},
+		{[]string{"vpn", "install", testServerID}, []string{"wireguard-install.sh"}},
+		{[]string{"setup", testServerID}, []string{"cat > '/home/user/setup.sh'", "sha256sum -c", "bash /home/user/setup.sh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args[:len(tt.args)-1], " "), func(t *testing.T) {
+			srv := newTestServer(t)
+			bin, logPath := fakeSSH(t)
+
+			args := append(tt.args, "--bin", bin, "--keyPath", "/tmp/id_test")
+			if _, err := runCommand(t, srv, args...); err != nil {
+				t.Fatalf("%v: %v", tt.args, err)
+			}
+
+			log := readLog(t, logPath)
+			if !strings.Contains(log, "-i /tmp/id_test -p 20022 user@203.0.113.10") {
+				t.Errorf("ssh not invoked with the forwarded port:\n%v", log)
+			}
+			if !strings.Contains(log, "-o HostKeyAlias="+testServerID) || !strings.Contains(log, "-o HashKnownHosts=no") {
+				t.Errorf("ssh not pointed at the pinned keys:\n%v", log)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(log, want) {
+					t.Errorf("ssh log missing %q:\n%v", want, log)
+				}
+			}
+		})
+	}
+}
+
+func TestSSHCommandUnknownServer(t *testing.T) {
+	srv := newTestServer(t)
+	bin, _ := fakeSSH(t)
+
+	_, err := runCommand(t, srv, "wolf", "logs", "missing", "--bin", bin)
+	if !errors.Is(err, api.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := runCommand(t, srv, "config", "--apiKey", "new-key", "--apiToken", "new-token", "--keyPath", "/tmp/id_test")
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+
+	data, err := os.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"apikey: new-key", "apitoken: new-token", "keypath: /tmp/id_test"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file missing %q:\n%s", want, data)
+		}
+	}
+}
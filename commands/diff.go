@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+type diffLine struct {
+	Op   byte // ' ', '-' or '+'
+	Text string
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format, or ""
+// when they are equal.
+func unifiedDiff(aName, bName, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change and the end of its hunk.
+		first := start
+		for first < len(lines) && lines[first].Op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		end, unchanged := first, 0
+		for i := first; i < len(lines) && unchanged <= 2*diffContext; i++ {
+			if lines[i].Op == ' ' {
+				unchanged++
+			} else {
+				unchanged, end = 0, i+1
+			}
+		}
+
+		from := max(first-diffContext, start)
+		to := min(end+diffContext, len(lines))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %v\n+++ %v\n", aName, bName)
+		}
+		aStart, bStart := lineNumbers(lines[:from])
+		aLen, bLen := lineNumbers(lines[from:to])
+		fmt.Fprintf(&out, "@@ -%v,%v +%v,%v @@\n", aStart+1, aLen, bStart+1, bLen)
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(&out, "%c%v\n", l.Op, l.Text)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// lineNumbers counts the lines of a and b in lines.
+func lineNumbers(lines []diffLine) (a, b int) {
+	for _, l := range lines {
+		if l.Op != '+' {
+			a++
+		}
+		if l.Op != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns a and b on their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
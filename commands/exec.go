@@ -0,0 +1,337 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execCmd = &cobra.Command{
+		Use:   "exec [flags] [server_id...] -- command",
+		Short: "Run a command on many servers at once",
+		Long: `Run a command over SSH on the given servers, every server (--all) or the
+servers matching --selector, a few at a time. Output lines are prefixed with
+the server name, a summary of exit codes follows, and the exit status is
+non-zero when the command failed anywhere.
+
+Selectors are comma separated key=value pairs that must all match: name
+(a glob), status, hostnode and location (a substring).`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: execFleet,
+	}
+)
+
+func init() {
+	flags := execCmd.Flags()
+	flags.Bool("all", false, "Run on every server")
+	flags.StringP("selector", "l", "", "Run on the servers matching, e.g. name=gpu-*,status=running")
+	flags.IntP("parallel", "p", 4, "Number of servers to run on at once")
+	addRemoteFlags(execCmd)
+	rootCmd.AddCommand(execCmd)
+}
+
+// selector matches servers on their fields.
+type selector map[string]string
+
+func parseSelector(s string) (selector, error) {
+	sel := selector{}
+	if s == "" {
+		return sel, nil
+	}
+
+	for _, term := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(term, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid selector %q, want key=value", term)
+		}
+		switch key {
+		case "name":
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid name pattern %q: %w", value, err)
+			}
+		case "status", "hostnode", "location":
+		default:
+			return nil, fmt.Errorf("unknown selector key %q, want name, status, hostnode or location", key)
+		}
+		sel[key] = strings.TrimSpace(value)
+	}
+	return sel, nil
+}
+
+func (sel selector) match(s serverItem) bool {
+	for key, value := range sel {
+		var ok bool
+		switch key {
+		case "name":
+			ok, _ = path.Match(value, s.Name)
+		case "status":
+			ok = strings.EqualFold(s.Status, value)
+		case "hostnode":
+			ok = s.HostNode == value
+		case "location":
+			ok = containsFold(s.Location, value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// execResult is the outcome of the command on one server.
+type execResult struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Exit     int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"`
+}
+
+func asExecResult(item interface{}) execResult {
+	return item.(execResult)
+}
+
+var execColumns = []column{
+	{Name: "Server ID", Value: func(i interface{}) interface{} { return asExecResult(i).ID }},
+	{Name: "Name", Value: func(i interface{}) interface{} { return asExecResult(i).Name }},
+	{Name: "Exit", Value: func(i interface{}) interface{} { return asExecResult(i).Exit }},
+	{
+		Name:  "Duration",
+		Value: func(i interface{}) interface{} { return asExecResult(i).Duration.Round(time.Millisecond) },
+		Sort:  func(i interface{}) interface{} { return int64(asExecResult(i).Duration) },
+	},
+	{Name: "Error", Value: func(i interface{}) interface{} {
+		var exitErr *remote.ExitError
+		if err := asExecResult(i).Err; err != nil && !errors.As(err, &exitErr) {
+			return err.Error()
+		}
+		return ""
+	}},
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix. Writers
+// sharing mu do not interleave within a line.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes a trailing line without a newline.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%v%s", p.prefix, line)
+	return err
+}
+
+// execTargets resolves the servers to run on from the arguments and flags.
+func execTargets(cmd *cobra.Command, ids []string) ([]serverItem, error) {
+	flags := cmd.Flags()
+
+	all, err := flags.GetBool("all")
+	if err != nil {
+		return nil, err
+	}
+	s, err := flags.GetString("selector")
+	if err != nil {
+		return nil, err
+	}
+	sel, err := parseSelector(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 && !all && s == "" {
+		return nil, fmt.Errorf("name the servers, or use --all or --selector")
+	}
+	if len(ids) > 0 && all {
+		return nil, fmt.Errorf("--all cannot be combined with server IDs")
+	}
+
+	res, err := client.ListServers(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		if _, ok := res.VirtualMachines[id]; !ok {
+			return nil, fmt.Errorf("server %v not found", id)
+		}
+		wanted[id] = true
+	}
+
+	var targets []serverItem
+	for id, vm := range res.VirtualMachines {
+		item := serverItem{ID: id, VirtualMachine: vm}
+		if len(wanted) > 0 && !wanted[id] {
+			continue
+		}
+		if sel.match(item) {
+			targets = append(targets, item)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Name != targets[j].Name {
+			return targets[i].Name < targets[j].Name
+		}
+		return targets[i].ID < targets[j].ID
+	})
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no server matches")
+	}
+	return targets, nil
+}
+
+func execFleet(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || dash == len(args) {
+		return fmt.Errorf("give the command to run after --")
+	}
+	command := strings.Join(args[dash:], " ")
+
+	parallel, err := flags.GetInt("parallel")
+	if err != nil {
+		return err
+	}
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+
+	targets, err := execTargets(cmd, args[:dash])
+	if err != nil {
+		return err
+	}
+
+	user, err := flags.GetString("user")
+	if err != nil {
+		return err
+	}
+	timeout, err := flags.GetDuration("connect-timeout")
+	if err != nil {
+		return err
+	}
+	cfg := remote.Config{User: user, KeyPath: client.KeyPath, Timeout: timeout}
+
+	width := 0
+	for _, s := range targets {
+		if n := len(execLabel(s)); n > width {
+			width = n
+		}
+	}
+
+	var mu sync.Mutex
+	results := make([]execResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < parallel && n < len(targets); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s := targets[i]
+				prefix := fmt.Sprintf("%-*v | ", width, execLabel(s))
+				stdout := &prefixWriter{w: cmd.OutOrStdout(), mu: &mu, prefix: prefix}
+				stderr := &prefixWriter{w: cmd.ErrOrStderr(), mu: &mu, prefix: prefix}
+
+				start := time.Now()
+				err := execOn(cmd, s.ID, cfg, command, stdout, stderr)
+				stdout.Flush()
+				stderr.Flush()
+
+				results[i] = execResult{ID: s.ID, Name: s.Name, Exit: execExitCode(err), Duration: time.Since(start), Err: err}
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	v := view{Columns: execColumns}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+		v.Items = append(v.Items, r)
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout())
+	if err := render(cmd, v); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("command failed on %v of %v servers", failed, len(targets))
+	}
+	return nil
+}
+
+func execLabel(s serverItem) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.ID
+}
+
+func execOn(cmd *cobra.Command, id string, cfg remote.Config, command string, stdout, stderr io.Writer) error {
+	c, err := remoteClient(cmd.Context(), id, cfg)
+	if err != nil {
+		return err
+	}
+	return c.Run(cmd.Context(), command, nil, stdout, stderr)
+}
+
+// execExitCode is the exit status of the command, or -1 when it did not
+// run to completion.
+func execExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *remote.ExitError
+	if errors.As(err, &exitErr) && exitErr.Signal == "" {
+		return exitErr.Status
+	}
+	return -1
+}
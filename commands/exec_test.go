@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+)
+
+func TestExec(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		if e.Command == "nvidia-smi -L" {
+			fmt.Fprintln(e.Stdout, "GPU 0: NVIDIA GeForce RTX 4090")
+		}
+		return 0
+	})
+
+	// A second server whose SSH port refuses connections.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	const downID = "99999999-2222-4333-8444-555555555555"
+	vm, _ := srv.VM(testServerID)
+	vm.Name = "render"
+	vm.PortForwards = map[string]string{closedPort: "22"}
+	srv.AddServer(downID, vm)
+
+	out, err := runCommand(t, srv, "exec", "--all", "--keyPath", sshSrv.KeyPath, "--", "nvidia-smi", "-L")
+	if err == nil || !strings.Contains(err.Error(), "failed on 1 of 2 servers") {
+		t.Fatalf("err = %v, want a failure on 1 of 2 servers", err)
+	}
+
+	if !strings.Contains(out, "gaming | GPU 0: NVIDIA GeForce RTX 4090") {
+		t.Errorf("output is not prefixed with the server name:\n%v", out)
+	}
+	for _, id := range []string{testServerID, downID} {
+		if !strings.Contains(out, id) {
+			t.Errorf("summary is missing %v:\n%v", id, out)
+		}
+	}
+
+	if _, err := runCommand(t, srv, "exec", "--selector", "name=gam*", "--keyPath", sshSrv.KeyPath, "--", "nvidia-smi", "-L"); err != nil {
+		t.Fatalf("exec --selector: %v", err)
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	sel, err := parseSelector("name=gpu-*,status=running")
+	if err != nil {
+		t.Fatalf("parseSelector: %v", err)
+	}
+
+	match := serverItem{}
+	match.Name, match.Status = "gpu-1", "running"
+	if !sel.match(match) {
+		t.Errorf("%v does not match %+v", sel, match)
+	}
+
+	other := match
+	other.Status = "stopped"
+	if sel.match(other) {
+		t.Errorf("%v matches %+v", sel, other)
+	}
+
+	for _, s := range []string{"name", "color=red", "name=["} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("parseSelector(%q) succeeded", s)
+		}
+	}
+}
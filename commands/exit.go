@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/raefon/td-stream/api"
+)
+
+// Exit codes returned by the CLI so scripts can tell failures apart.
+const (
+	exitError              = 1
+	exitAPIError           = 2
+	exitInvalidCredentials = 3
+	exitOutOfStock         = 4
+	exitNotFound           = 5
+	exitRateLimited        = 6
+	exitMaintenance        = 7
+	exitTimeout            = 8
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, api.ErrInvalidCredentials):
+		return exitInvalidCredentials
+	case errors.Is(err, api.ErrOutOfStock):
+		return exitOutOfStock
+	case errors.Is(err, api.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, api.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, api.ErrMaintenance):
+		return exitMaintenance
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	}
+
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) {
+		return exitAPIError
+	}
+	return exitError
+}
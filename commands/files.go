@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/spf13/cobra"
+)
+
+// bundledFiles reads the files embedded in fsys. Scripts are made
+// executable.
+func bundledFiles(fsys fs.FS) ([]remote.File, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]remote.File, 0, len(entries))
+	for _, entry := range entries {
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mode := fs.FileMode(0o644)
+		if strings.HasSuffix(entry.Name(), ".sh") {
+			mode = 0o755
+		}
+		files = append(files, remote.File{Name: entry.Name(), Mode: mode, Data: data})
+	}
+	return files, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// uploadFiles copies the files of fsys into dir on the server, skipping
+// those whose checksum already matches, and verifies the result so the
+// server runs exactly the scripts of this CLI version.
+func uploadFiles(cmd *cobra.Command, server, dir string, fsys fs.FS) error {
+	files, err := bundledFiles(fsys)
+	if err != nil {
+		return err
+	}
+
+	bin, err := cmd.Flags().GetString("bin")
+	if err != nil {
+		return err
+	}
+	if bin != "" {
+		return uploadFilesWithBin(cmd, server, dir, files)
+	}
+
+	c, err := sshClient(cmd, server)
+	if err != nil {
+		return err
+	}
+	return syncFiles(cmd.Context(), c, dir, files)
+}
+
+// syncFiles uploads the files missing or different in dir and verifies
+// the result.
+func syncFiles(ctx context.Context, c *remote.Client, dir string, files []remote.File) error {
+	sums, err := remoteChecksums(ctx, c, dir, files)
+	if err != nil {
+		return err
+	}
+
+	var stale []remote.File
+	for _, f := range files {
+		if sums[path.Join(dir, f.Name)] != checksum(f.Data) {
+			stale = append(stale, f)
+		}
+	}
+	if len(stale) == 0 {
+		log.Printf("files in %v are up to date", dir)
+		return nil
+	}
+
+	if _, err := c.Output(ctx, "mkdir -p -- "+remote.Quote(dir)); err != nil {
+		return err
+	}
+	for _, f := range stale {
+		log.Printf("uploading %v", path.Join(dir, f.Name))
+	}
+	if err := c.Upload(ctx, dir, stale...); err != nil {
+		return err
+	}
+
+	if sums, err = remoteChecksums(ctx, c, dir, files); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if name := path.Join(dir, f.Name); sums[name] != checksum(f.Data) {
+			return fmt.Errorf("%v does not match the bundled file after upload", name)
+		}
+	}
+	return nil
+}
+
+// remoteChecksums returns the sha256 of the files in dir that exist on the
+// server, keyed by path.
+func remoteChecksums(ctx context.Context, c *remote.Client, dir string, files []remote.File) (map[string]string, error) {
+	args := make([]string, len(files))
+	for i, f := range files {
+		args[i] = remote.Quote(path.Join(dir, f.Name))
+	}
+
+	// sha256sum fails when a file is missing, the others are still listed.
+	res, err := c.Output(ctx, "sha256sum -- "+strings.Join(args, " "))
+	var exitErr *remote.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(res.Stdout), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if ok {
+			sums[name] = sum
+		}
+	}
+	return sums, nil
+}
+
+// uploadFilesWithBin streams every file through the external SSH client and
+// has the server check its checksum.
+func uploadFilesWithBin(cmd *cobra.Command, server, dir string, files []remote.File) error {
+	flags := cmd.Flags()
+
+	bin, err := flags.GetString("bin")
+	if err != nil {
+		return err
+	}
+	user, err := flags.GetString("user")
+	if err != nil {
+		return err
+	}
+	keyPath, err := flags.GetString("keyPath")
+	if err != nil {
+		return err
+	}
+	if keyPath == "" {
+		keyPath = client.KeyPath
+	}
+
+	for _, f := range files {
+		name := remote.Quote(path.Join(dir, f.Name))
+		command := fmt.Sprintf("mkdir -p -- %v && cat > %v && chmod %o %v && echo %v | sha256sum -c --quiet",
+			remote.Quote(dir), name, f.Mode.Perm(), name, remote.Quote(checksum(f.Data)+"  "+path.Join(dir, f.Name)))
+
+		if err := executeSSHCommand(cmd.Context(), server, bin, user, keyPath, command, bytes.NewReader(f.Data), cmd.OutOrStdout()); err != nil {
+			return fmt.Errorf("uploading %v: %w", f.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/state"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	knownHostsCmd = &cobra.Command{
+		Use:   "known-hosts",
+		Short: "Manage the host keys pinned for servers",
+	}
+	knownHostsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List pinned host keys",
+		Args:  cobra.NoArgs,
+		RunE:  listKnownHosts,
+	}
+	knownHostsForgetCmd = &cobra.Command{
+		Use:   "forget server_id",
+		Short: "Forget the host key pinned for a server",
+		Args:  cobra.ExactArgs(1),
+		RunE:  forgetKnownHost,
+	}
+)
+
+func init() {
+	knownHostsCmd.AddCommand(knownHostsListCmd)
+	knownHostsCmd.AddCommand(knownHostsForgetCmd)
+	rootCmd.AddCommand(knownHostsCmd)
+}
+
+// knownHostsStores holds one store per file so every connection shares it.
+var (
+	knownHostsMu     sync.Mutex
+	knownHostsStores = map[string]*remote.KnownHosts{}
+)
+
+// knownHosts returns the host key store shared by every SSH connection.
+func knownHosts() (*remote.KnownHosts, error) {
+	path, err := state.Path("known_hosts")
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	kh, ok := knownHostsStores[path]
+	if !ok {
+		kh = remote.NewKnownHosts(path)
+		knownHostsStores[path] = kh
+	}
+	return kh, nil
+}
+
+// forgetHostKey drops the key pinned for a deleted server.
+func forgetHostKey(serverId string) error {
+	kh, err := knownHosts()
+	if err != nil {
+		return err
+	}
+
+	forgotten, err := kh.Forget(serverId)
+	if err != nil {
+		return err
+	}
+	if forgotten {
+		log.Printf("forgot the host key of %v", serverId)
+	}
+	return nil
+}
+
+var knownHostColumns = []column{
+	{Name: "Server ID", Value: func(i interface{}) interface{} { return i.(remote.HostKey).ID }},
+	{Name: "Type", Value: func(i interface{}) interface{} { return i.(remote.HostKey).Key.Type() }},
+	{Name: "Fingerprint", Value: func(i interface{}) interface{} { return ssh.FingerprintSHA256(i.(remote.HostKey).Key) }},
+}
+
+func listKnownHosts(cmd *cobra.Command, args []string) error {
+	kh, err := knownHosts()
+	if err != nil {
+		return err
+	}
+
+	keys, err := kh.Keys()
+	if err != nil {
+		return err
+	}
+
+	v := view{Columns: knownHostColumns}
+	for _, key := range keys {
+		v.Items = append(v.Items, key)
+	}
+	return render(cmd, v)
+}
+
+func forgetKnownHost(cmd *cobra.Command, args []string) error {
+	kh, err := knownHosts()
+	if err != nil {
+		return err
+	}
+
+	forgotten, err := kh.Forget(args[0])
+	if err != nil {
+		return err
+	}
+	if !forgotten {
+		return fmt.Errorf("no host key pinned for %v", args[0])
+	}
+	return nil
+}
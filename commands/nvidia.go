@@ -1,9 +1,15 @@
 package commands
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 )
 
+// nvidiaRebootMarker is printed by the driver install right before it
+// reboots the server.
+const nvidiaRebootMarker = "Complete.... Rebooting."
+
 var (
 	nvidiaCmd = &cobra.Command{
 		Use:   "nvidia",
@@ -16,27 +22,20 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			serverID := args[0]
 
-			cmd.Flags().String("bin", "ssh", "Name of SSH client executable (e.g., ssh, mosh)")
-			cmd.Flags().String("user", "user", "User account to use for login")
-			cmd.Flags().String("command", "", "Command to execute over SSH")
-
 			return nvidiaInstall(cmd, serverID)
 		},
 	}
 )
 
 func init() {
+	addSSHFlags(nvidiaInstallCmd)
 	nvidiaCmd.AddCommand(nvidiaInstallCmd)
 	rootCmd.AddCommand(nvidiaCmd)
 }
 
 func nvidiaInstall(cmd *cobra.Command, server string) error {
 
-	startScriptCommand := "sudo add-apt-repository ppa:graphics-drivers/ppa -y && sudo apt update && sudo apt install nvidia-driver-535 -y && echo 'Complete.... Rebooting.' && sudo reboot"
-
-	// Set the command to be executed over SSH
-	cmd.Flags().Set("command", startScriptCommand)
+	startScriptCommand := fmt.Sprintf("sudo add-apt-repository ppa:graphics-drivers/ppa -y && sudo apt update && sudo apt install nvidia-driver-535 -y && echo '%v' && sudo reboot", nvidiaRebootMarker)
 
-	// Execute the SSH command to run the script
-	return sshServer(cmd, []string{server})
+	return runScript(cmd, server, startScriptCommand)
 }
@@ -0,0 +1,338 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by --output.
+const (
+	outputTable = "table"
+	outputWide  = "wide"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+)
+
+// column is one field of a view. Wide columns are only shown by the wide
+// and csv formats unless selected with --columns.
+type column struct {
+	Name  string
+	Wide  bool
+	Value func(item interface{}) interface{}
+	// Sort returns the value to sort on when Value is formatted for
+	// display, e.g. "24GB" instead of 24.
+	Sort func(item interface{}) interface{}
+}
+
+func (c column) sortValue(item interface{}) interface{} {
+	if c.Sort != nil {
+		return c.Sort(item)
+	}
+	return c.Value(item)
+}
+
+// key is the name used to select the column with --columns and to label it
+// in structured output, e.g. "GPU Price" becomes "gpu_price".
+func (c column) key() string {
+	return strings.ReplaceAll(strings.ToLower(c.Name), " ", "_")
+}
+
+// view is what a read command hands to render. Items are marshalled as-is
+// for json/yaml and are the dot of --format templates, Columns drive the
+// tabular formats.
+type view struct {
+	Columns []column
+	Items   []interface{}
+	// Vertical renders a single item as a property/value table.
+	Vertical bool
+}
+
+// render writes v to the command's output in the format selected by the
+// global output flags.
+func render(cmd *cobra.Command, v view) error {
+	w := cmd.OutOrStdout()
+	flags := cmd.Flags()
+
+	format, err := flags.GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "" {
+		return renderTemplate(w, format, v.Items)
+	}
+
+	output := viper.GetString("output")
+	names, err := flags.GetStringSlice("columns")
+	if err != nil {
+		return err
+	}
+
+	columns, err := selectColumns(v.Columns, names, output)
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case outputTable, outputWide, "":
+		renderTable(w, v, columns)
+		return nil
+	case outputCSV:
+		return renderCSV(w, v.Items, columns)
+	case outputJSON, outputYAML:
+		var data interface{} = v.Items
+		if len(names) > 0 {
+			data = project(v.Items, columns)
+		}
+		if v.Vertical && len(v.Items) == 1 {
+			data = singleItem(data)
+		}
+		if output == outputJSON {
+			return renderJSON(w, data)
+		}
+		return renderYAML(w, data)
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+}
+
+// findColumn looks a column up by its key or name.
+func findColumn(columns []column, name string) (column, error) {
+	name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+	for _, c := range columns {
+		if c.key() == name {
+			return c, nil
+		}
+	}
+
+	keys := make([]string, len(columns))
+	for i, c := range columns {
+		keys[i] = c.key()
+	}
+	return column{}, fmt.Errorf("unknown column %q, available columns: %v", name, strings.Join(keys, ", "))
+}
+
+// sortItems sorts items on the given column, keeping the current order of
+// equal items.
+func sortItems(items []interface{}, columns []column, name string, desc bool) error {
+	c, err := findColumn(columns, name)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		cmp := compareValues(c.sortValue(items[i]), c.sortValue(items[j]))
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return nil
+}
+
+func compareValues(a, b interface{}) int {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func selectColumns(columns []column, names []string, output string) ([]column, error) {
+	if len(names) == 0 {
+		var selected []column
+		for _, c := range columns {
+			if !c.Wide || output == outputWide || output == outputCSV {
+				selected = append(selected, c)
+			}
+		}
+		return selected, nil
+	}
+
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		c, err := findColumn(columns, name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+func renderTable(w io.Writer, v view, columns []column) {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+
+	// A single value, e.g. a server status, is printed bare so it stays
+	// easy to consume from scripts.
+	if len(columns) == 1 && len(v.Items) == 1 && v.Vertical {
+		fmt.Fprintln(w, columns[0].Value(v.Items[0]))
+		return
+	}
+
+	if v.Vertical {
+		t.AppendHeader(table.Row{"Property", "Value"})
+		for _, item := range v.Items {
+			for _, c := range columns {
+				t.AppendRow(table.Row{c.Name, c.Value(item)})
+			}
+		}
+		t.Render()
+		return
+	}
+
+	header := make(table.Row, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	t.AppendHeader(header)
+
+	for _, item := range v.Items {
+		row := make(table.Row, len(columns))
+		for i, c := range columns {
+			row[i] = c.Value(item)
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+}
+
+func renderCSV(w io.Writer, items []interface{}, columns []column) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.key()
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = fmt.Sprint(c.Value(item))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func renderJSON(w io.Writer, data interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// renderYAML goes through JSON so the json tags of the API types are used
+// as keys, then drops the flow style inherited from the JSON document.
+func renderYAML(w io.Writer, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	clearStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+func renderTemplate(w io.Writer, format string, items []interface{}) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join": func(sep string, v []string) string {
+			return strings.Join(v, sep)
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid --format template: %w", err)
+	}
+
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// project keeps only the selected columns of every item.
+func project(items []interface{}, columns []column) []interface{} {
+	projected := make([]interface{}, len(items))
+	for i, item := range items {
+		values := make(map[string]interface{}, len(columns))
+		for _, c := range columns {
+			values[c.key()] = c.Value(item)
+		}
+		projected[i] = values
+	}
+	return projected
+}
+
+func singleItem(data interface{}) interface{} {
+	if items, ok := data.([]interface{}); ok && len(items) == 1 {
+		return items[0]
+	}
+	return data
+}
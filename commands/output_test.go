@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestOutputJSON(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "list", "-o", "json")
+	if err != nil {
+		t.Fatalf("servers list: %v", err)
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid json: %v\n%v", err, out)
+	}
+	if len(items) != 1 || items[0]["id"] != testServerID || items[0]["ip_address"] != "203.0.113.10" {
+		t.Errorf("items = %v", items)
+	}
+}
+
+func TestOutputYAMLSingleItem(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "info", testServerID, "-o", "yaml")
+	if err != nil {
+		t.Fatalf("servers info: %v", err)
+	}
+
+	var item map[string]interface{}
+	if err := yaml.Unmarshal([]byte(out), &item); err != nil {
+		t.Fatalf("invalid yaml: %v\n%v", err, out)
+	}
+	if item["name"] != "gaming" {
+		t.Errorf("item = %v", item)
+	}
+}
+
+func TestOutputCSVColumns(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "list", "-o", "csv", "--columns", "server_id,ip")
+	if err != nil {
+		t.Fatalf("servers list: %v", err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v\n%v", err, out)
+	}
+	want := [][]string{{"server_id", "ip"}, {testServerID, "203.0.113.10"}}
+	if len(records) != 2 || strings.Join(records[0], ",") != strings.Join(want[0], ",") || strings.Join(records[1], ",") != strings.Join(want[1], ",") {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
+
+func TestOutputWide(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "list")
+	if err != nil {
+		t.Fatalf("servers list: %v", err)
+	}
+	if strings.Contains(out, "203.0.113.10") {
+		t.Errorf("table output shows wide column:\n%v", out)
+	}
+
+	out, err = runCommand(t, srv, "servers", "list", "-o", "wide")
+	if err != nil {
+		t.Fatalf("servers list -o wide: %v", err)
+	}
+	if !strings.Contains(out, "203.0.113.10") {
+		t.Errorf("wide output missing IP:\n%v", out)
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "list", "--format", "{{.ID}} {{.IP}}")
+	if err != nil {
+		t.Fatalf("servers list: %v", err)
+	}
+	if strings.TrimSpace(out) != testServerID+" 203.0.113.10" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestOutputUnknownColumn(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := runCommand(t, srv, "servers", "list", "--columns", "nope")
+	if err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Fatalf("err = %v, want unknown column", err)
+	}
+}
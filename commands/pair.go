@@ -0,0 +1,299 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pairCmd = &cobra.Command{
+		Use:   "pair server_id",
+		Short: "Pair Moonlight with the Wolf instance of a server",
+		Long: `Pair Moonlight with the Wolf instance of a server.
+
+pair prints the address to add in Moonlight, waits for Moonlight's pairing
+request to show up in the Wolf log, then submits the PIN Moonlight displays
+(from --pin or asked for on the terminal) and records the paired client.`,
+		Args: cobra.ExactArgs(1),
+		RunE: pairServer,
+	}
+)
+
+// Wolf's Moonlight HTTP and HTTPS ports.
+const (
+	wolfHTTPPort  = 47989
+	wolfHTTPSPort = 47984
+)
+
+// pinURL matches the pairing link Wolf logs, e.g.
+// "Insert pin at http://0.0.0.0:47989/pin/#337327E8A6FC0C66".
+var pinURL = regexp.MustCompile(`/pin/#([0-9A-Za-z]+)`)
+
+func init() {
+	flags := pairCmd.Flags()
+	flags.String("pin", "", "PIN shown by Moonlight; asked for when not given")
+	flags.String("name", "", "Name to record the client under (default: this machine's hostname)")
+	flags.Duration("wait-timeout", 5*time.Minute, "How long to wait for Moonlight")
+	addRemoteFlags(pairCmd)
+	rootCmd.AddCommand(pairCmd)
+}
+
+// pairedClient is a Moonlight client td-stream paired with a server.
+type pairedClient struct {
+	Name        string    `json:"name"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Address     string    `json:"address"`
+	PairedAt    time.Time `json:"paired_at"`
+}
+
+func pairedStateName(serverId string) string {
+	return "paired/" + serverId + ".json"
+}
+
+// wolfAddresses returns the addresses Moonlight reaches Wolf's HTTP and
+// HTTPS ports on.
+func wolfAddresses(cmd *cobra.Command, serverId string) (string, string, error) {
+	res, err := client.GetServer(cmd.Context(), serverId)
+	if err != nil {
+		return "", "", err
+	}
+	vm := res.VirtualMachines
+	return net.JoinHostPort(vm.IP, forwardedPort(vm, wolfHTTPPort)),
+		net.JoinHostPort(vm.IP, forwardedPort(vm, wolfHTTPSPort)), nil
+}
+
+// lineWriter calls fn with every line written to it.
+type lineWriter struct {
+	fn  func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// waitForPairing follows the Wolf log until Moonlight asks to pair and
+// returns the secret of the request.
+func waitForPairing(ctx context.Context, c *remote.Client) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	secrets := make(chan string, 1)
+	w := &lineWriter{fn: func(line string) {
+		if m := pinURL.FindStringSubmatch(line); m != nil {
+			select {
+			case secrets <- m[1]:
+			default:
+			}
+		}
+	}}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Run(ctx, "docker logs --follow --tail 0 "+wolfContainer, nil, w, w)
+	}()
+
+	select {
+	case secret := <-secrets:
+		return secret, nil
+	case err := <-errs:
+		select {
+		case secret := <-secrets:
+			return secret, nil
+		default:
+		}
+		if err == nil {
+			err = fmt.Errorf("wolf log ended")
+		}
+		return "", fmt.Errorf("waiting for a pairing request: %w", err)
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for a pairing request: %w", ctx.Err())
+	}
+}
+
+// submitPIN sends the PIN for a pairing request to Wolf. Wolf only takes
+// it over plain HTTP, so the request goes through the SSH connection to
+// Wolf's local port instead of over the internet to the forwarded one.
+func submitPIN(ctx context.Context, c *remote.Client, secret, pin string) error {
+	body, err := json.Marshal(map[string]string{"pin": pin, "secret": secret})
+	if err != nil {
+		return err
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{DialContext: dialer(c)},
+		Timeout:   30 * time.Second,
+	}
+	addr := fmt.Sprintf("127.0.0.1:%v", wolfHTTPPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/pin/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("submitting the PIN: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("submitting the PIN: wolf answered %v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// readPIN asks for the PIN on the terminal.
+func readPIN(cmd *cobra.Command) (string, error) {
+	fmt.Fprint(cmd.ErrOrStderr(), "Enter the PIN Moonlight shows: ")
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading the PIN: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// pairedFingerprints returns the fingerprints of the clients in config.toml.
+func pairedFingerprints(cmd *cobra.Command, c *remote.Client) (map[string]bool, error) {
+	doc, _, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := map[string]bool{}
+	for _, client := range cfg.PairedClients {
+		if fp, err := client.Fingerprint(); err == nil {
+			fingerprints[fp] = true
+		}
+	}
+	return fingerprints, nil
+}
+
+// waitForNewClient polls config.toml until a client missing from known
+// shows up and returns its fingerprint.
+func waitForNewClient(ctx context.Context, cmd *cobra.Command, c *remote.Client, known map[string]bool) (string, error) {
+	var fingerprint string
+	opts := api.WaitOptions{Interval: time.Second, MaxInterval: 3 * time.Second}
+	err := api.Poll(ctx, "paired", opts, func(ctx context.Context) (string, bool, error) {
+		current, err := pairedFingerprints(cmd, c)
+		if err != nil {
+			return "", false, err
+		}
+		for fp := range current {
+			if !known[fp] {
+				fingerprint = fp
+				return "paired", true, nil
+			}
+		}
+		return "waiting for Moonlight", false, nil
+	})
+	return fingerprint, err
+}
+
+func pairServer(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	serverId := args[0]
+
+	pin, err := flags.GetString("pin")
+	if err != nil {
+		return err
+	}
+	name, err := flags.GetString("name")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if name, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	timeout, err := flags.GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+
+	httpAddress, httpsAddress, err := wolfAddresses(cmd, serverId)
+	if err != nil {
+		return err
+	}
+
+	c, err := sshClient(cmd, serverId)
+	if err != nil {
+		return err
+	}
+
+	known, err := pairedFingerprints(cmd, c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "In Moonlight, add the host %v and select it to pair (HTTPS is on %v)\n", httpAddress, httpsAddress)
+	secret, err := waitForPairing(ctx, c)
+	if err != nil {
+		return err
+	}
+	log.Print("pairing request received")
+
+	if pin == "" {
+		if pin, err = readPIN(cmd); err != nil {
+			return err
+		}
+	}
+	if err := submitPIN(ctx, c, secret, pin); err != nil {
+		return err
+	}
+
+	fingerprint, err := waitForNewClient(ctx, cmd, c, known)
+	if err != nil {
+		return fmt.Errorf("waiting for Moonlight to finish pairing: %w", err)
+	}
+
+	var clients []pairedClient
+	if err := state.Load(pairedStateName(serverId), &clients); err != nil {
+		return err
+	}
+	clients = append(clients, pairedClient{
+		Name:        name,
+		Fingerprint: fingerprint,
+		Address:     httpAddress,
+		PairedAt:    time.Now().UTC(),
+	})
+	if err := state.Save(pairedStateName(serverId), clients); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "paired %v with %v\n", name, serverId)
+	return nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/raefon/td-stream/state"
+)
+
+// testCertificate returns a self-signed certificate in PEM form.
+func testCertificate(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Moonlight"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestPair(t *testing.T) {
+	srv := newTestServer(t)
+	host := &wolfHost{config: testWolfConfig}
+	handler := func(e remotetest.Exec) int {
+		if e.Command == "docker logs --follow --tail 0 wolf-wolf-1" {
+			io.WriteString(e.Stdout, "[HTTP] Pairing request from Moonlight\n")
+			io.WriteString(e.Stdout, "Insert pin at http://0.0.0.0:47989/pin/#5EC12E7\n")
+			return 0
+		}
+		return host.handle(e)
+	}
+	sshSrv := newSSHServer(t, srv, handler)
+
+	cert := testCertificate(t)
+	var got map[string]string
+	wolfHTTP := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/pin/" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		// Moonlight completes the pairing once the PIN is in.
+		host.mu.Lock()
+		host.config = strings.Replace(host.config, "hostname = \"Wolf\"\n",
+			fmt.Sprintf("hostname = \"Wolf\"\n\n[[paired_clients]]\nclient_cert = %q\n", cert), 1)
+		host.mu.Unlock()
+	}))
+	t.Cleanup(wolfHTTP.Close)
+	sshSrv.Redirect("127.0.0.1:47989", wolfHTTP.Listener.Addr().String())
+
+	// The PIN goes through SSH, never to the forwarded port.
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to the forwarded port: %v %v", r.Method, r.URL)
+	}))
+	t.Cleanup(public.Close)
+
+	_, httpPort, _ := net.SplitHostPort(public.Listener.Addr().String())
+	vm, _ := srv.VM(testServerID)
+	vm.PortForwards[httpPort] = "47989"
+	srv.AddServer(testServerID, vm)
+
+	out, err := runCommand(t, srv, "pair", testServerID, "--pin", "1234", "--name", "laptop", "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("pair: %v\n%v", err, out)
+	}
+	if !strings.Contains(out, "127.0.0.1:"+httpPort) || !strings.Contains(out, "paired laptop") {
+		t.Errorf("output:\n%v", out)
+	}
+	if got["pin"] != "1234" || got["secret"] != "5EC12E7" {
+		t.Errorf("wolf got %v", got)
+	}
+
+	var clients []pairedClient
+	if err := state.Load(pairedStateName(testServerID), &clients); err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 || clients[0].Name != "laptop" || clients[0].Fingerprint == "" {
+		t.Errorf("recorded clients = %+v", clients)
+	}
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/raefon/td-stream/state"
+)
+
+// portPresets are the names accepted by --internal_ports in place of a port
+// list. The wolf preset covers SSH plus the ports Wolf exposes to Moonlight.
+var portPresets = map[string]string{
+	"wolf": "22,47984,47989,48010,47998-48000/udp",
+}
+
+// parsePortSpec parses a comma separated list of ports, port ranges like
+// 47998-48000 and presets. A trailing /tcp or /udp is accepted and ignored
+// as the marketplace forwards both protocols.
+func parsePortSpec(spec string) ([]int, error) {
+	if preset, ok := portPresets[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = preset
+	}
+
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		part = strings.TrimSuffix(strings.TrimSuffix(part, "/tcp"), "/udp")
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parsePort(last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+
+		for port := start; port <= end; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", spec)
+	}
+	return ports, nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
+
+func portStrings(ports []int) []string {
+	values := make([]string, len(ports))
+	for i, port := range ports {
+		values[i] = strconv.Itoa(port)
+	}
+	return values
+}
+
+// portMapping is an external port picked for a server and the internal
+// port it forwards to.
+type portMapping struct {
+	Internal int `json:"internal"`
+	External int `json:"external"`
+}
+
+// portsStateName is the state file of the ports picked for a server.
+func portsStateName(serverId string) string {
+	return "ports/" + serverId + ".json"
+}
+
+// recordPorts logs and saves the external ports picked for a new server.
+// The server exists already, so a failed save is only a warning.
+func recordPorts(serverId string, internal, external []int) {
+	mapping := make([]portMapping, len(internal))
+	for i := range internal {
+		log.Printf("port %v -> %v", internal[i], external[i])
+		mapping[i] = portMapping{Internal: internal[i], External: external[i]}
+	}
+	if err := state.Save(portsStateName(serverId), mapping); err != nil {
+		log.Printf("warning: saving the ports of %v: %v", serverId, err)
+	}
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/state"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+		err  bool
+	}{
+		{"80,443", []int{80, 443}, false},
+		{" 22 , 47998-48000/udp", []int{22, 47998, 47999, 48000}, false},
+		{"wolf", []int{22, 47984, 47989, 48010, 47998, 47999, 48000}, false},
+		{"48000-47998", nil, true},
+		{"http", nil, true},
+		{"70000", nil, true},
+		{"", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePortSpec(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("parsePortSpec(%q) err = %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestServersDeployAutoPorts(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "deploy", "new", "secret",
+		"--hostnode", testHostNode,
+		"--internal_ports", "wolf",
+		"--auto-ports",
+	)
+	if err != nil {
+		t.Fatalf("servers deploy --auto-ports: %v", err)
+	}
+
+	vm, ok := srv.VM(strings.TrimSpace(out))
+	if !ok {
+		t.Fatalf("servers deploy --auto-ports: server not created:\n%v", out)
+	}
+	want := map[string]string{
+		"20000": "22", "20001": "47984", "20002": "47989", "20003": "48010",
+		"20004": "47998", "20005": "47999", "20006": "48000",
+	}
+	if !reflect.DeepEqual(vm.PortForwards, want) {
+		t.Errorf("port forwards = %v, want %v", vm.PortForwards, want)
+	}
+
+	var mapping []portMapping
+	if err := state.Load(portsStateName(strings.TrimSpace(out)), &mapping); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 7 || mapping[1] != (portMapping{Internal: 47984, External: 20001}) {
+		t.Errorf("recorded ports = %+v", mapping)
+	}
+
+	_, err = runCommand(t, srv, "servers", "deploy", "new", "secret",
+		"--hostnode", testHostNode,
+		"--auto-ports",
+		"--external_ports", "20010,20011",
+	)
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("--auto-ports with --external_ports: err = %v", err)
+	}
+}
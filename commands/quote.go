@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	quoteCmd = &cobra.Command{
+		Use:   "quote",
+		Short: "Price a server configuration on one or all matching hostnodes",
+		Args:  cobra.NoArgs,
+		RunE:  quoteConfig,
+	}
+)
+
+func init() {
+	flags := quoteCmd.Flags()
+	flags.String("gpuModel", "geforcertx4090-pcie-24gb", "The GPU model that you would like to provision")
+	flags.Int("gpuCount", 1, "The number of GPUs of the model you specified earlier")
+	flags.Int("vcpus", 2, "Number of vCPUs that you would like")
+	flags.Int("ram", 4, "Number of GB of RAM to be deployed.")
+	flags.Int("storage", 20, "Number of GB of networked storage")
+	flags.String("hostnode", "", "Only price the configuration on this hostnode")
+	addStockFilterFlags(quoteCmd)
+	rootCmd.AddCommand(quoteCmd)
+}
+
+// quoteItem is the price of a configuration on one hostnode.
+type quoteItem struct {
+	HostNode string           `json:"hostnode"`
+	Location string           `json:"location"`
+	Config   api.ServerConfig `json:"config"`
+	api.Quote
+}
+
+func asQuote(item interface{}) quoteItem {
+	return item.(quoteItem)
+}
+
+func price(value float64) string {
+	return fmt.Sprintf("$%.4f", value)
+}
+
+var quoteColumns = []column{
+	{Name: "HostNode ID", Value: func(i interface{}) interface{} { return asQuote(i).HostNode }},
+	{Name: "Location", Value: func(i interface{}) interface{} { return asQuote(i).Location }},
+	{Name: "GPU", Value: func(i interface{}) interface{} {
+		return fmt.Sprintf("%vx %v", asQuote(i).Config.GPUCount, asQuote(i).Config.GPUModel)
+	}},
+	{
+		Name:  "GPU Cost",
+		Value: func(i interface{}) interface{} { return price(asQuote(i).GPU) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).GPU },
+	},
+	{
+		Name:  "CPU Cost",
+		Value: func(i interface{}) interface{} { return price(asQuote(i).CPU) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).CPU },
+	},
+	{
+		Name:  "RAM Cost",
+		Value: func(i interface{}) interface{} { return price(asQuote(i).RAM) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).RAM },
+	},
+	{
+		Name:  "Storage Cost",
+		Value: func(i interface{}) interface{} { return price(asQuote(i).Storage) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).Storage },
+	},
+	{
+		Name:  "Hourly",
+		Value: func(i interface{}) interface{} { return price(asQuote(i).Hourly) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).Hourly },
+	},
+	{
+		Name:  "Monthly",
+		Value: func(i interface{}) interface{} { return fmt.Sprintf("$%.2f", asQuote(i).Monthly) },
+		Sort:  func(i interface{}) interface{} { return asQuote(i).Monthly },
+	},
+}
+
+// serverConfigFromFlags reads the hardware flags shared by quote and deploy.
+func serverConfigFromFlags(cmd *cobra.Command) (api.ServerConfig, error) {
+	flags := cmd.Flags()
+	var cfg api.ServerConfig
+	var err error
+
+	if cfg.GPUModel, err = flags.GetString("gpuModel"); err != nil {
+		return cfg, err
+	}
+	if cfg.GPUCount, err = flags.GetInt("gpuCount"); err != nil {
+		return cfg, err
+	}
+	if cfg.VCPUs, err = flags.GetInt("vcpus"); err != nil {
+		return cfg, err
+	}
+	if cfg.RAM, err = flags.GetInt("ram"); err != nil {
+		return cfg, err
+	}
+	if cfg.Storage, err = flags.GetInt("storage"); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func newQuoteItem(hostID string, host api.HostNode, cfg api.ServerConfig) (quoteItem, error) {
+	q, err := host.Quote(cfg)
+	if err != nil {
+		return quoteItem{}, fmt.Errorf("hostnode %v: %w", hostID, err)
+	}
+
+	return quoteItem{
+		HostNode: hostID,
+		Location: fmt.Sprintf("%s, %s", host.Location.City, host.Location.Region),
+		Config:   cfg,
+		Quote:    q,
+	}, nil
+}
+
+// renderQuote prints the breakdown of a single quote.
+func renderQuote(cmd *cobra.Command, item quoteItem) error {
+	return render(cmd, view{
+		Columns:  quoteColumns,
+		Items:    []interface{}{item},
+		Vertical: true,
+	})
+}
+
+func quoteConfig(cmd *cobra.Command, args []string) error {
+	cfg, err := serverConfigFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	hostnode, err := cmd.Flags().GetString("hostnode")
+	if err != nil {
+		return err
+	}
+
+	filter, err := stockFilterFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.ListStock(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if hostnode != "" {
+		host, ok := res.HostNode[hostnode]
+		if !ok {
+			return fmt.Errorf("hostnode %v not found", hostnode)
+		}
+
+		item, err := newQuoteItem(hostnode, host, cfg)
+		if err != nil {
+			return err
+		}
+		return renderQuote(cmd, item)
+	}
+
+	v := view{Columns: quoteColumns}
+	for _, stock := range stockItems(res, filter) {
+		if stock.GPU.Name != cfg.GPUModel || stock.GPU.Amount < cfg.GPUCount {
+			continue
+		}
+
+		item, err := newQuoteItem(stock.ID, stock.HostNode, cfg)
+		if err != nil {
+			return err
+		}
+		v.Items = append(v.Items, item)
+	}
+
+	if len(v.Items) == 0 {
+		return fmt.Errorf("no hostnode has %vx %v in stock", cfg.GPUCount, cfg.GPUModel)
+	}
+
+	if err := sortItems(v.Items, v.Columns, "hourly", false); err != nil {
+		return err
+	}
+
+	return render(cmd, v)
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteAllHostNodes(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "quote", "--vcpus", "4", "--ram", "16", "--storage", "100",
+		"-o", "csv", "--columns", "hostnode_id,hourly,monthly")
+	if err != nil {
+		t.Fatalf("quote: %v", err)
+	}
+
+	want := "hostnode_id,hourly,monthly\n" +
+		testHostNode + ",$0.4190,$305.87\n" +
+		"7b8c9d0e-1f2a-4b3c-9d4e-5f6a7b8c9d0e,$0.4820,$351.86\n"
+	if out != want {
+		t.Errorf("got:\n%v\nwant:\n%v", out, want)
+	}
+}
+
+func TestQuoteNoStock(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := runCommand(t, srv, "quote", "--gpuModel", "geforcertx3060-pcie-12gb")
+	if err == nil || !strings.Contains(err.Error(), "no hostnode") {
+		t.Fatalf("err = %v, want no hostnode error", err)
+	}
+}
+
+func TestDeployDryRun(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "servers", "deploy", "new", "secret", "--dry-run",
+		"--hostnode", testHostNode, "--vcpus", "4", "--ram", "16", "--storage", "100",
+		"--external_ports", "20001,20002")
+	if err != nil {
+		t.Fatalf("servers deploy --dry-run: %v", err)
+	}
+
+	for _, want := range []string{"GPU Cost", "$0.3700", "CPU Cost", "$0.0120", "Hourly", "$0.4190"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%v", want, out)
+		}
+	}
+	if srv.Calls("deploy/single") != 0 {
+		t.Error("dry run called deploy/single")
+	}
+}
@@ -1,9 +1,12 @@
 package commands
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/raefon/td-stream/api"
 	"github.com/spf13/cobra"
@@ -22,9 +25,14 @@ var (
 )
 
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	sessions.Close()
 	if err != nil {
-		os.Exit(1)
+		stop()
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -37,11 +45,26 @@ func init() {
 	pflags.String("apiToken", "", "API token")
 	pflags.Bool("debug", false, "Enable debug mode")
 	pflags.String("keyPath", "", "Path to SSH key")
+	pflags.Duration("timeout", 30*time.Second, "Timeout for a single API request (0 disables it)")
+	pflags.Int("retries", api.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for idempotent API requests")
+	pflags.StringP("output", "o", outputTable, "Output format: table, wide, json, yaml or csv")
+	pflags.StringSlice("columns", nil, "Comma separated columns to show, e.g. name,status")
+	pflags.String("format", "", "Go template applied to every item, e.g. '{{.IP}}'")
+
+	bindFlags()
+}
+
+// bindFlags binds the global flags to their viper keys.
+func bindFlags() {
+	pflags := rootCmd.PersistentFlags()
 
 	viper.BindPFlag("apiKey", pflags.Lookup("apiKey"))
 	viper.BindPFlag("apiToken", pflags.Lookup("apiToken"))
 	viper.BindPFlag("debug", pflags.Lookup("debug"))
 	viper.BindPFlag("keyPath", pflags.Lookup("keyPath"))
+	viper.BindPFlag("timeout", pflags.Lookup("timeout"))
+	viper.BindPFlag("retries", pflags.Lookup("retries"))
+	viper.BindPFlag("output", pflags.Lookup("output"))
 }
 
 func initConfig() {
@@ -68,7 +91,13 @@ func initConfig() {
 	apiToken := viper.GetString("apiToken")
 	debug := viper.GetBool("debug")
 	keyPath := viper.GetString("keyPath")
+	timeout := viper.GetDuration("timeout")
 
-	client = api.NewClient(serviceUrl, apiKey, apiToken, debug, keyPath)
+	retry := api.DefaultRetryPolicy
+	retry.MaxAttempts = viper.GetInt("retries")
 
+	client = api.NewClient(serviceUrl, apiKey, apiToken, debug, keyPath,
+		api.WithTimeout(timeout),
+		api.WithRetry(retry),
+	)
 }
@@ -4,12 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
-	"strings"
+	"sort"
 
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/state"
 	"github.com/spf13/cobra"
 )
 
@@ -66,15 +64,6 @@ var (
 			RunE:  manageServer,
 		}
 	*/
-	// need to implement
-	/*
-		sshCmd = &cobra.Command{
-			Use:   "ssh server_id",
-			Short: "Launch an SSH sesion with a server",
-			Args:  cobra.ExactArgs(1),
-			RunE:  sshServer,
-		}
-	*/
 	restartCmd = &cobra.Command{
 		Use:     "restart [flags] server_id",
 		Short:   "Restart a server",
@@ -109,17 +98,7 @@ func init() {
 	serversCmd.AddCommand(deleteCmd)
 
 	serversCmd.AddCommand(deployCmd)
-	deployCmd.Flags().String("gpuModel", "geforcertx4090-pcie-24gb", "The GPU model that you would like to provision")
-	deployCmd.Flags().String("location", "", "Location")
-	deployCmd.Flags().String("hostnode", "c136d11f-2ac8-469f-ad2c-8eac05e2a155", "UUID of the hostnode you want to deploy the server on. Can be omitted if location is set.")
-	deployCmd.Flags().Int("gpuCount", 1, "The number of GPUs of the model you specified earlier")
-	deployCmd.Flags().String("cpuModel", "AMD EPYC 75F3", "The CPU model that you would like to provision")
-	deployCmd.Flags().Int("vcpus", 2, "Number of vCPUs that you would like")
-	deployCmd.Flags().Int("storage", 20, "Number of GB of networked storage")
-	deployCmd.Flags().Int("ram", 4, "Number of GB of RAM to be deployed.")
-	deployCmd.Flags().String("operating_system", "Ubuntu 22.04 LTS", "Operating system")
-	deployCmd.Flags().String("internal_ports", "80,443", "Internal ports to be used by the server")
-	deployCmd.Flags().String("external_ports", "47600,46701", "External ports to be used by the server")
+	addDeployFlags(deployCmd, "80,443", false)
 
 	serversCmd.AddCommand(restartCmd)
 
@@ -137,206 +116,332 @@ func init() {
 
 }
 
+// addDeployFlags registers the flags read by runDeploy with the given port
+// defaults.
+func addDeployFlags(cmd *cobra.Command, internalPorts string, autoPorts bool) {
+	flags := cmd.Flags()
+	flags.String("gpuModel", "geforcertx4090-pcie-24gb", "The GPU model that you would like to provision")
+	flags.String("location", "", "Only let --auto pick hostnodes in this region, country or city")
+	flags.String("hostnode", "", "UUID of the hostnode you want to deploy the server on. Can be omitted if --auto is set.")
+	flags.Int("gpuCount", 1, "The number of GPUs of the model you specified earlier")
+	flags.String("cpuModel", "AMD EPYC 75F3", "The CPU model that you would like to provision")
+	flags.Int("vcpus", 2, "Number of vCPUs that you would like")
+	flags.Int("storage", 20, "Number of GB of networked storage")
+	flags.Int("ram", 4, "Number of GB of RAM to be deployed.")
+	flags.String("operating_system", "Ubuntu 22.04 LTS", "Operating system")
+	flags.String("internal_ports", internalPorts, "Internal ports to be used by the server, ranges like 47998-48000 or the wolf preset")
+	flags.String("external_ports", "47600,46701", "External ports to be used by the server")
+	flags.Bool("auto-ports", autoPorts, "Pick free external ports of the hostnode for every internal port")
+	flags.Bool("dry-run", false, "Print the price of the configuration without deploying it")
+	flags.Bool("auto", false, "Deploy on the cheapest hostnode that fits the configuration")
+	flags.String("prefer-region", "", "Region, state or continent preferred by --auto when prices and uptime tie")
+	flags.Int("candidates", 5, "Number of hostnodes shown by --auto")
+	flags.Bool("skip-validation", false, "Deploy without checking the configuration against the hostnode first")
+}
+
+// serverItem is a server as rendered by the read commands.
+type serverItem struct {
+	ID string `json:"id"`
+	api.VirtualMachine
+}
+
+func asServer(item interface{}) serverItem {
+	return item.(serverItem)
+}
+
+var serverColumns = []column{
+	{Name: "Name", Value: func(i interface{}) interface{} { return asServer(i).Name }},
+	{Name: "Server ID", Value: func(i interface{}) interface{} { return asServer(i).ID }},
+	{Name: "Status", Value: func(i interface{}) interface{} { return asServer(i).Status }},
+	{Name: "IP", Wide: true, Value: func(i interface{}) interface{} { return asServer(i).IP }},
+	{Name: "GPU", Wide: true, Value: func(i interface{}) interface{} {
+		return fmt.Sprintf("%vx %v", asServer(i).Specs.GPU.Amount, asServer(i).Specs.GPU.Type)
+	}},
+	{Name: "Location", Wide: true, Value: func(i interface{}) interface{} { return asServer(i).Location }},
+	{Name: "Cost", Wide: true, Value: func(i interface{}) interface{} { return asServer(i).Cost }},
+}
+
+var serverInfoColumns = []column{
+	{Name: "ID", Value: func(i interface{}) interface{} { return asServer(i).ID }},
+	{Name: "Name", Value: func(i interface{}) interface{} { return asServer(i).Name }},
+	{Name: "Location", Value: func(i interface{}) interface{} { return asServer(i).Location }},
+	{Name: "HostNode", Value: func(i interface{}) interface{} { return asServer(i).HostNode }},
+	{Name: "IP", Value: func(i interface{}) interface{} { return asServer(i).IP }},
+	{Name: "Charged Cost", Value: func(i interface{}) interface{} { return asServer(i).Cost }},
+	{Name: "Status", Value: func(i interface{}) interface{} { return asServer(i).Status }},
+	{Name: "Type", Value: func(i interface{}) interface{} { return asServer(i).Type }},
+	{Name: "vCPUs", Value: func(i interface{}) interface{} { return asServer(i).Specs.VCPUs }},
+	{Name: "RAM", Value: func(i interface{}) interface{} { return fmt.Sprintf("%vGB", asServer(i).Specs.RAM) }},
+	{Name: "Storage", Value: func(i interface{}) interface{} { return fmt.Sprintf("%vGB", asServer(i).Specs.STORAGE) }},
+	{Name: "Operating System", Value: func(i interface{}) interface{} { return asServer(i).OperatingSystem }},
+	{Name: "Port Forwards", Value: func(i interface{}) interface{} { return asServer(i).PortForwards }},
+	{Name: "GPU Amount", Value: func(i interface{}) interface{} { return asServer(i).Specs.GPU.Amount }},
+	{Name: "GPU Type", Value: func(i interface{}) interface{} { return asServer(i).Specs.GPU.Type }},
+	{Name: "Creation Timestamp", Value: func(i interface{}) interface{} { return asServer(i).TimestampCreation }},
+}
+
 func serverList(cmd *cobra.Command, args []string) error {
-	res, err := client.ListServers()
+	res, err := client.ListServers(cmd.Context())
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
+	items := make([]serverItem, 0, len(res.VirtualMachines))
+	for serverID, details := range res.VirtualMachines {
+		items = append(items, serverItem{ID: serverID, VirtualMachine: details})
 	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID < items[j].ID
+	})
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Name", "Server ID", "Status"})
-
-	for serverID, details := range res.VirtualMachines {
-		serverName := details.Name     // Adjust field names as per actual struct definition
-		serverStatus := details.Status // Adjust field names as per actual struct definition
-		t.AppendRow(table.Row{serverName, serverID, serverStatus})
+	v := view{Columns: serverColumns}
+	for _, item := range items {
+		v.Items = append(v.Items, item)
 	}
-	t.Render()
 
-	return nil
+	return render(cmd, v)
 }
 
 func serverInfo(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.GetServer(server)
+	res, err := client.GetServer(cmd.Context(), server)
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
-	props := []map[string]string{
-		//{"name": "ID", "value": res.VirtualMachines.ServerID},
-		{"name": "Name", "value": res.VirtualMachines.Name},
-		{"name": "Location", "value": res.VirtualMachines.Location},
-		{"name": "HostNode", "value": res.VirtualMachines.HostNode},
-		{"name": "IP", "value": res.VirtualMachines.IP},
-		{"name": "Charged Cost", "value": fmt.Sprintf("%v", res.VirtualMachines.Cost)},
-		{"name": "Status", "value": res.VirtualMachines.Status},
-		{"name": "Type", "value": res.VirtualMachines.Type},
-		{"name": "vCPUs", "value": strconv.Itoa(res.VirtualMachines.Specs.VCPUs)},
-		{"name": "RAM", "value": fmt.Sprintf("%vGB", res.VirtualMachines.Specs.RAM)},
-		{"name": "Storage", "value": fmt.Sprintf("%vGB", res.VirtualMachines.Specs.STORAGE)},
-		{"name": "Operating System", "value": res.VirtualMachines.OperatingSystem},
-		{"name": "Port Forwards", "value": fmt.Sprintf("%v", res.VirtualMachines.PortForwards)},
-		{"name": "GPU Amount", "value": strconv.Itoa(res.VirtualMachines.Specs.GPU.Amount)},
-		{"name": "GPU Type", "value": res.VirtualMachines.Specs.GPU.Type},
-		{"name": "Creation Timestamp", "value": res.VirtualMachines.TimestampCreation},
-	}
-
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Property", "Value"})
-	for _, elem := range props {
-		t.AppendRow(table.Row{elem["name"], elem["value"]})
-	}
-	t.Render()
-
-	return nil
+	return render(cmd, view{
+		Columns:  serverInfoColumns,
+		Items:    []interface{}{serverItem{ID: server, VirtualMachine: res.VirtualMachines}},
+		Vertical: true,
+	})
 }
 
 func startServer(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.StartServer(server)
-	if err != nil {
+	if _, err := client.StartServer(cmd.Context(), server); err != nil {
 		return err
 	}
-
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
-	return nil
+	return waitIfRequested(cmd, server, "running")
 }
 
 func stopServer(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.StopServer(server)
-	if err != nil {
+	if _, err := client.StopServer(cmd.Context(), server); err != nil {
 		return err
 	}
-
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
-	return nil
+	return waitIfRequested(cmd, server, "stopped")
 }
 
 func deleteServer(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.DeleteServer(server)
-	if err != nil {
+	if _, err := client.DeleteServer(cmd.Context(), server); err != nil {
 		return err
 	}
-
-	if !res.Success {
-		return errors.New(res.Error)
+	if err := forgetHostKey(server); err != nil {
+		log.Printf("warning: %v", err)
 	}
-
-	return nil
+	if err := state.Remove(portsStateName(server)); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	return waitIfRequested(cmd, server, api.StatusDeleted)
 }
 
 // deployServer deploys a server by making a request to the API with the specified parameters.
 func deployServer(cmd *cobra.Command, args []string) error {
+	id, err := runDeploy(cmd, args[0], args[1])
+	if err != nil || id == "" {
+		return err
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), id)
+	return waitIfRequested(cmd, id, "running")
+}
+
+// runDeploy deploys the server described by the deploy flags of cmd and
+// returns its ID, or an empty ID for a dry run.
+func runDeploy(cmd *cobra.Command, name, password string) (string, error) {
 	flags := cmd.Flags()
 
 	// Retrieve all parameters and check for their presence
+	auto, err := flags.GetBool("auto")
+	if err != nil {
+		return "", err
+	}
+
 	hostnode, err := flags.GetString("hostnode")
-	if err != nil || hostnode == "" {
-		return errors.New("hostnode is required")
+	if err != nil {
+		return "", err
+	}
+
+	location, err := flags.GetString("location")
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case auto && hostnode != "":
+		return "", errors.New("--hostnode cannot be combined with --auto")
+	case !auto && location != "":
+		return "", errors.New("--location only applies to --auto")
+	case !auto && hostnode == "":
+		return "", errors.New("hostnode is required, or use --auto to pick one")
 	}
 
 	gpuModel, err := flags.GetString("gpuModel")
 	if err != nil || gpuModel == "" {
-		return errors.New("gpuModel is required")
+		return "", errors.New("gpuModel is required")
 	}
 
 	gpuCount, err := flags.GetInt("gpuCount")
 	if err != nil {
-		return errors.New("gpuCount is required")
+		return "", errors.New("gpuCount is required")
 	}
 
 	vcpus, err := flags.GetInt("vcpus")
 	if err != nil {
-		return errors.New("vcpus is required")
+		return "", errors.New("vcpus is required")
 	}
 
 	ram, err := flags.GetInt("ram")
 	if err != nil {
-		return errors.New("ram is required")
+		return "", errors.New("ram is required")
 	}
 
 	storage, err := flags.GetInt("storage")
 	if err != nil {
-		return errors.New("storage is required")
+		return "", errors.New("storage is required")
 	}
 
 	operatingSystem, err := flags.GetString("operating_system")
 	if err != nil || operatingSystem == "" {
-		return errors.New("operating_system is required")
+		return "", errors.New("operating_system is required")
 	}
 
 	internalPorts, err := flags.GetString("internal_ports")
 	if err != nil || internalPorts == "" {
-		return errors.New("internal_ports is required")
+		return "", errors.New("internal_ports is required")
+	}
+
+	internal, err := parsePortSpec(internalPorts)
+	if err != nil {
+		return "", err
+	}
+
+	autoPorts, err := flags.GetBool("auto-ports")
+	if err != nil {
+		return "", err
 	}
 
-	internalPortsSlice := strings.Split(internalPorts, ",")
+	// Explicit external ports are rarely free on every hostnode, so --auto
+	// allocates them unless they were given.
+	switch {
+	case flags.Changed("external_ports") && flags.Changed("auto-ports") && autoPorts:
+		return "", errors.New("--external_ports cannot be combined with --auto-ports")
+	case flags.Changed("external_ports"):
+		autoPorts = false
+	case auto:
+		autoPorts = true
+	}
 
 	externalPorts, err := flags.GetString("external_ports")
 	if err != nil || externalPorts == "" {
-		return errors.New("external_ports is required")
+		return "", errors.New("external_ports is required")
 	}
 
-	externalPortsSlice := strings.Split(externalPorts, ",")
+	var external []int
+	if !autoPorts {
+		if external, err = parsePortSpec(externalPorts); err != nil {
+			return "", err
+		}
+		if len(external) != len(internal) {
+			return "", fmt.Errorf("%v internal ports but %v external ports", len(internal), len(external))
+		}
+	}
 
 	// Initialize the request with all mandatory fields
 	req := api.DeployServerRequest{
 		HostNode:        hostnode,
-		Name:            args[0],
-		Password:        args[1],
+		Name:            name,
+		Password:        password,
 		GPUModel:        gpuModel,
 		GPUCount:        gpuCount,
 		VCPUs:           vcpus,
 		RAM:             ram,
 		Storage:         storage,
 		OperatingSystem: operatingSystem,
-		InternalPorts:   internalPortsSlice,
-		ExternalPorts:   externalPortsSlice,
+		InternalPorts:   portStrings(internal),
+		ExternalPorts:   portStrings(external),
 	}
 
-	res, err := client.DeployServer(req)
+	dryRun, err := flags.GetBool("dry-run")
 	if err != nil {
-		return err
+		return "", err
 	}
-	if !res.Success {
-		return errors.New(res.Error)
+
+	skipValidation, err := flags.GetBool("skip-validation")
+	if err != nil {
+		return "", err
 	}
 
-	fmt.Println(res.Server)
-	return nil
+	if auto {
+		return deployAuto(cmd, req, internal, external, dryRun, skipValidation)
+	}
+
+	if dryRun || !skipValidation || autoPorts {
+		stock, err := client.ListStock(cmd.Context())
+		if err != nil {
+			return "", err
+		}
+
+		host, ok := stock.HostNode[hostnode]
+		if !ok {
+			return "", fmt.Errorf("hostnode %v not found in stock: %w", hostnode, api.ErrOutOfStock)
+		}
+
+		if autoPorts {
+			external, err = host.AllocatePorts(internal)
+			if err != nil {
+				return "", err
+			}
+			req.ExternalPorts = portStrings(external)
+		}
+
+		if !skipValidation {
+			if err := host.Validate(hostnode, req.Config(), external); err != nil {
+				return "", err
+			}
+		}
+
+		if dryRun {
+			item, err := newQuoteItem(hostnode, host, req.Config())
+			if err != nil {
+				return "", err
+			}
+			return "", renderQuote(cmd, item)
+		}
+	}
+
+	res, err := client.DeployServer(cmd.Context(), req)
+	if err != nil {
+		return "", err
+	}
+	if autoPorts {
+		recordPorts(res.Server, internal, external)
+	}
+	return res.Server, nil
 }
 
 // need to fix
 /* func manageServer(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.GetServer(server)
+	res, err := client.GetServer(cmd.Context(), server)
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
 	err = browser.OpenURL(res.Server.Links["dashboard"]["href"])
 	if err != nil {
 		return err
@@ -352,16 +457,10 @@ func logAction(message string) func(*cobra.Command, []string) {
 
 func restartServer(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.RestartServer(server)
-	if err != nil {
+	if _, err := client.RestartServer(cmd.Context(), server); err != nil {
 		return err
 	}
-
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
-	return nil
+	return waitIfRequested(cmd, server, "running")
 }
 
 func modifyServer(cmd *cobra.Command, args []string) error {
@@ -424,31 +523,50 @@ func modifyServer(cmd *cobra.Command, args []string) error {
 	req.GPUModel = gpuModel
 	req.GPUCount = gpuCount
 
-	res, err := client.ModifyServer(req)
-
+	// A modified server comes back in the state it had before, so that is
+	// what --wait waits for.
+	wait, err := flags.GetBool("wait")
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
+	var before string
+	if wait {
+		res, err := client.GetServerStatus(cmd.Context(), serverId)
+		if err != nil {
+			return err
+		}
+		before = res.Status
 	}
 
+	if _, err := client.ModifyServer(cmd.Context(), req); err != nil {
+		return err
+	}
+
+	if wait {
+		return waitForServer(cmd, serverId, before)
+	}
 	return nil
 }
 
+// statusItem is the answer of `servers status`.
+type statusItem struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
 func serverStatus(cmd *cobra.Command, args []string) error {
 	server := args[0]
-	res, err := client.GetServerStatus(server)
+	res, err := client.GetServerStatus(cmd.Context(), server)
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
-	}
-
-	fmt.Println(res.Status)
-
-	return nil
+	return render(cmd, view{
+		Columns: []column{
+			{Name: "Status", Value: func(i interface{}) interface{} { return i.(statusItem).Status }},
+		},
+		Items:    []interface{}{statusItem{ID: server, Status: res.Status}},
+		Vertical: true,
+	})
 }
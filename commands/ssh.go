@@ -1,19 +1,57 @@
 package commands
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/state"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-func sshServer(cmd *cobra.Command, args []string) error {
+// sessions holds the SSH connections opened by the built-in client so the
+// commands of an install share one connection per server.
+var sessions = remote.NewPool()
+
+// addSSHFlags registers the flags shared by every command that runs over SSH.
+func addSSHFlags(cmd *cobra.Command) {
+	cmd.Flags().String("bin", "", "Run this SSH client executable (e.g., ssh, mosh) instead of the built-in client")
+	cmd.Flags().String("user", "user", "User account to use for login")
+	cmd.Flags().String("command", "", "Command to execute over SSH")
+	cmd.Flags().Duration("connect-timeout", remote.DefaultTimeout, "Timeout for connecting to the server")
+}
+
+// addRemoteFlags registers the SSH flags of commands that only work with the
+// built-in client.
+func addRemoteFlags(cmd *cobra.Command) {
+	cmd.Flags().String("user", "user", "User account to use for login")
+	cmd.Flags().Duration("connect-timeout", remote.DefaultTimeout, "Timeout for connecting to the server")
+}
+
+// runScript runs a scripted install or docker command on a server, through
+// the external client when --bin is set.
+func runScript(cmd *cobra.Command, server, command string) error {
+	return runOnServer(cmd, server, command, false)
+}
+
+// runInteractive runs an installer that asks questions. Like ssh -t it gets
+// a PTY on a terminal, otherwise it reads its answers from a pipe.
+func runInteractive(cmd *cobra.Command, server, command string) error {
+	return runOnServer(cmd, server, command, true)
+}
+
+func runOnServer(cmd *cobra.Command, server, command string, interactive bool) error {
 	flags := cmd.Flags()
 
-	server := args[0]
 	bin, err := flags.GetString("bin")
 	if err != nil {
 		return err
@@ -28,38 +66,120 @@ func sshServer(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	command, err := flags.GetString("command")
+	if keyPath == "" {
+		keyPath = client.KeyPath
+	}
+
+	// Scripted steps get no stdin so they neither wait for input nor eat
+	// the user's.
+	var stdin io.Reader
+	if interactive {
+		stdin = os.Stdin
+	}
+	if bin != "" {
+		return executeSSHCommand(cmd.Context(), server, bin, user, keyPath, command, stdin, cmd.OutOrStdout())
+	}
+
+	c, err := sshClient(cmd, server)
 	if err != nil {
 		return err
 	}
+	if interactive {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return c.Shell(cmd.Context(), command, os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		}
+		stdin = pipedStdin()
+	}
+	return c.Run(cmd.Context(), command, stdin, cmd.OutOrStdout(), cmd.ErrOrStderr())
+}
 
-	return executeSSHCommand(server, bin, user, keyPath, command)
+// pipedStdin returns os.Stdin when it is a pipe or a redirected file, and
+// nil otherwise.
+func pipedStdin() io.Reader {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return nil
+	}
+	if info.Mode()&os.ModeNamedPipe != 0 || info.Mode().IsRegular() {
+		return os.Stdin
+	}
+	return nil
 }
 
-func executeSSHCommand(serverId, bin, user, keyPath, command string) error {
-	res, err := client.GetServer(serverId)
+// sshClient returns the built-in SSH client for a server, configured by the
+// SSH flags of cmd.
+func sshClient(cmd *cobra.Command, server string) (*remote.Client, error) {
+	flags := cmd.Flags()
+
+	user, err := flags.GetString("user")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	keyPath, err := flags.GetString("keyPath")
+	if err != nil {
+		return nil, err
+	}
+	if keyPath == "" {
+		keyPath = client.KeyPath
+	}
+
+	timeout, err := flags.GetDuration("connect-timeout")
+	if err != nil {
+		return nil, err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
+	return remoteClient(cmd.Context(), server, remote.Config{User: user, KeyPath: keyPath, Timeout: timeout})
+}
+
+// remoteClient returns the pooled built-in SSH client for a server.
+func remoteClient(ctx context.Context, serverId string, cfg remote.Config) (*remote.Client, error) {
+	res, err := client.GetServer(ctx, serverId)
+	if err != nil {
+		return nil, err
 	}
 
-	// Default SSH port
-	sshPort := "22"
+	kh, err := knownHosts()
+	if err != nil {
+		return nil, err
+	}
+	cfg.HostKeyCallback = kh.Callback(serverId)
+	cfg.HostKeyAlgorithms = kh.Algorithms(serverId)
+
+	return sessions.Client(sshAddress(res.VirtualMachines), cfg), nil
+}
 
-	// Check for port forwarding and adjust the SSH port accordingly
-	for externalPort, internalPort := range res.VirtualMachines.PortForwards {
-		if internalPort == "22" {
-			sshPort = externalPort
-			break
+// executeSSHCommand runs command through an external SSH client. opts are
+// passed to the client before the destination.
+func executeSSHCommand(ctx context.Context, serverId, bin, user, keyPath, command string, stdin io.Reader, stdout io.Writer, opts ...string) error {
+	res, err := client.GetServer(ctx, serverId)
+	if err != nil {
+		return err
+	}
+
+	vm := res.VirtualMachines
+	host, sshPort, _ := net.SplitHostPort(sshAddress(vm))
+
+	args := append(opts, "-i", keyPath, "-p", sshPort, fmt.Sprintf("%v@%v", user, host), command)
+
+	// OpenSSH can check the keys td-stream pinned, keyed by server ID
+	// rather than by the shared IP.
+	if filepath.Base(bin) == "ssh" {
+		path, err := state.Path("known_hosts")
+		if err != nil {
+			return err
 		}
+		args = append([]string{
+			"-o", "HostKeyAlias=" + serverId,
+			"-o", "UserKnownHostsFile=" + path,
+			"-o", "StrictHostKeyChecking=accept-new",
+			"-o", "HashKnownHosts=no",
+		}, args...)
 	}
 
-	sshCmd := exec.Command(bin, "-i", keyPath, "-p", sshPort, fmt.Sprintf("%v@%v", user, res.VirtualMachines.IP), command)
-	sshCmd.Stdin = os.Stdin
-	sshCmd.Stdout = os.Stdout
+	sshCmd := exec.CommandContext(ctx, bin, args...)
+	sshCmd.Stdin = stdin
+	sshCmd.Stdout = stdout
 	sshCmd.Stderr = os.Stderr
 
 	if err := sshCmd.Run(); err != nil {
@@ -69,13 +189,27 @@ func executeSSHCommand(serverId, bin, user, keyPath, command string) error {
 	return nil
 }
 
+// sshAddress returns the host:port the server's SSH daemon is reachable on,
+// following the port forward of port 22 when there is one.
+func sshAddress(vm api.VirtualMachine) string {
+	return net.JoinHostPort(vm.IP, forwardedPort(vm, 22))
+}
+
+// forwardedPort returns the external port an internal port of the server is
+// forwarded to, or the port itself when it is not forwarded.
+func forwardedPort(vm api.VirtualMachine, internal int) string {
+	port := strconv.Itoa(internal)
+	for external, in := range vm.PortForwards {
+		if in == port {
+			return external
+		}
+	}
+	return port
+}
+
 func dockerCommandsViaSSH(cmd *cobra.Command, args []string) error {
 	server := args[0]
 	dockerCommand := strings.Join(args[1:], " ") // Join all arguments after the server ID as the Docker command
 
-	// Set up flags for the SSH command
-	cmd.Flags().Set("command", dockerCommand)
-
-	// Call sshServer to handle the SSH connection and command execution
-	return sshServer(cmd, []string{server})
+	return runScript(cmd, server, dockerCommand)
 }
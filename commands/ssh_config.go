@@ -0,0 +1,291 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/raefon/td-stream/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sshConfigCmd = &cobra.Command{
+		Use:   "ssh-config",
+		Short: "Generate OpenSSH config entries for every server",
+		Long: `Generate OpenSSH Host entries for every server, so plain ssh, scp, rsync
+and editors with remote support can reach them by name.
+
+Without --file or --sync the entries are printed. With --file they are merged
+into that file, which is meant to be pulled into ~/.ssh/config with an
+Include line; entries of servers that no longer exist are kept unless --sync
+is set. --sync writes to ~/.ssh/td-stream.config unless --file says
+otherwise.`,
+		Args: cobra.NoArgs,
+		RunE: sshConfig,
+	}
+)
+
+func init() {
+	flags := sshConfigCmd.Flags()
+	flags.String("user", "user", "User account to use for login")
+	flags.String("file", "", "Merge the entries into this file instead of printing them")
+	flags.Bool("sync", false, "Also remove the entries of servers that no longer exist")
+	rootCmd.AddCommand(sshConfigCmd)
+}
+
+const (
+	sshConfigBegin = "# BEGIN td-stream "
+	sshConfigEnd   = "# END td-stream "
+)
+
+// sshHost is the OpenSSH config entry of one server.
+type sshHost struct {
+	ID             string
+	Alias          string
+	HostName       string
+	Port           string
+	User           string
+	IdentityFile   string
+	KnownHostsFile string
+}
+
+func (h sshHost) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v%v\n", sshConfigBegin, h.ID)
+	if h.Alias != "" {
+		fmt.Fprintf(&b, "Host %v %v\n", h.Alias, h.ID)
+	} else {
+		fmt.Fprintf(&b, "Host %v\n", h.ID)
+	}
+	fmt.Fprintf(&b, "    HostName %v\n", h.HostName)
+	fmt.Fprintf(&b, "    Port %v\n", h.Port)
+	fmt.Fprintf(&b, "    User %v\n", h.User)
+	if h.IdentityFile != "" {
+		fmt.Fprintf(&b, "    IdentityFile %v\n", quoteSSHConfig(h.IdentityFile))
+		b.WriteString("    IdentitiesOnly yes\n")
+	}
+	// Servers share IPs, so host keys are checked against the keys
+	// td-stream pinned for the server ID.
+	fmt.Fprintf(&b, "    HostKeyAlias %v\n", h.ID)
+	fmt.Fprintf(&b, "    UserKnownHostsFile %v\n", quoteSSHConfig(h.KnownHostsFile))
+	// Hashed entries could no longer be matched to a server ID.
+	b.WriteString("    HashKnownHosts no\n")
+	fmt.Fprintf(&b, "%v%v\n", sshConfigEnd, h.ID)
+	return b.String()
+}
+
+func quoteSSHConfig(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+var aliasInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// sshAlias turns a server name into a Host alias.
+func sshAlias(name string) string {
+	return strings.Trim(aliasInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+}
+
+// sshHosts builds the entries of every server, ordered by alias. Servers
+// sharing a name get the first part of their ID appended to the alias.
+func sshHosts(cmd *cobra.Command) ([]sshHost, error) {
+	user, err := cmd.Flags().GetString("user")
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsFile, err := state.Path("known_hosts")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.ListServers(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]int{}
+	for _, vm := range res.VirtualMachines {
+		names[sshAlias(vm.Name)]++
+	}
+
+	hosts := make([]sshHost, 0, len(res.VirtualMachines))
+	for id, vm := range res.VirtualMachines {
+		host, port, _ := net.SplitHostPort(sshAddress(vm))
+		alias := sshAlias(vm.Name)
+		if alias != "" && names[alias] > 1 {
+			alias = fmt.Sprintf("%v-%.8v", alias, id)
+		}
+
+		hosts = append(hosts, sshHost{
+			ID:             id,
+			Alias:          alias,
+			HostName:       host,
+			Port:           port,
+			User:           user,
+			IdentityFile:   client.KeyPath,
+			KnownHostsFile: knownHostsFile,
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Alias != hosts[j].Alias {
+			return hosts[i].Alias < hosts[j].Alias
+		}
+		return hosts[i].ID < hosts[j].ID
+	})
+
+	return hosts, nil
+}
+
+// mergeSSHConfig replaces the td-stream entries in config with hosts. Lines
+// outside the entries are kept, as are entries of servers missing from
+// hosts unless prune is set. New entries are appended.
+func mergeSSHConfig(config []byte, hosts []sshHost, prune bool) []byte {
+	current := make(map[string]sshHost, len(hosts))
+	for _, h := range hosts {
+		current[h.ID] = h
+	}
+
+	var out bytes.Buffer
+	written := map[string]bool{}
+	skipping := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if skipping != "" {
+			if strings.TrimSpace(line) == sshConfigEnd+skipping {
+				skipping = ""
+			}
+			continue
+		}
+
+		if id := strings.TrimPrefix(strings.TrimSpace(line), sshConfigBegin); id != strings.TrimSpace(line) {
+			h, ok := current[id]
+			switch {
+			case ok && !written[id]:
+				out.WriteString(h.String())
+				written[id] = true
+			case !ok && !prune:
+				// Keep the stale entry as it is.
+				out.WriteString(line + "\n")
+				continue
+			}
+			skipping = id
+			continue
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	for _, h := range hosts {
+		if written[h.ID] {
+			continue
+		}
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n\n")) {
+			out.WriteString("\n")
+		}
+		out.WriteString(h.String())
+	}
+
+	return out.Bytes()
+}
+
+func defaultSSHConfigFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "td-stream.config"), nil
+}
+
+func sshConfig(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	path, err := flags.GetString("file")
+	if err != nil {
+		return err
+	}
+
+	prune, err := flags.GetBool("sync")
+	if err != nil {
+		return err
+	}
+
+	hosts, err := sshHosts(cmd)
+	if err != nil {
+		return err
+	}
+
+	if path == "" && !prune {
+		for i, h := range hosts {
+			if i > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			fmt.Fprint(cmd.OutOrStdout(), h)
+		}
+		return nil
+	}
+
+	if path == "" {
+		if path, err = defaultSSHConfigFile(); err != nil {
+			return err
+		}
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, mergeSSHConfig(existing, hosts, prune), 0o600); err != nil {
+		return err
+	}
+	log.Printf("wrote %v entries to %v", len(hosts), path)
+
+	if !sshConfigIncludes(path) {
+		log.Printf("add \"Include %v\" to the top of ~/.ssh/config to use them", path)
+	}
+	return nil
+}
+
+// sshConfigIncludes reports whether ~/.ssh/config mentions path in an
+// Include line.
+func sshConfigIncludes(path string) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "include") {
+			continue
+		}
+		for _, include := range fields[1:] {
+			include = strings.Replace(include, "~", home, 1)
+			if include == path || filepath.Join(home, ".ssh", include) == path {
+				return true
+			}
+		}
+	}
+	return false
+}
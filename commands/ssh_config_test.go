@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHConfig(t *testing.T) {
+	srv := newTestServer(t)
+
+	out, err := runCommand(t, srv, "ssh-config", "--keyPath", "/tmp/id_test")
+	if err != nil {
+		t.Fatalf("ssh-config: %v", err)
+	}
+
+	for _, want := range []string{
+		"Host gaming " + testServerID + "\n",
+		"    HostName 203.0.113.10\n",
+		"    Port 20022\n",
+		"    User user\n",
+		"    IdentityFile /tmp/id_test\n",
+		"    HostKeyAlias " + testServerID + "\n",
+		"    HashKnownHosts no\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ssh-config output missing %q:\n%v", want, out)
+		}
+	}
+}
+
+func TestSSHConfigSync(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "td-stream.config")
+
+	const stale = "00000000-0000-4000-8000-000000000000"
+	existing := "# my own host\nHost build\n    HostName build.example\n\n" +
+		sshHost{ID: stale, Alias: "old", HostName: "192.0.2.1", Port: "22", User: "user"}.String()
+	if err := os.WriteFile(path, []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runCommand(t, srv, "ssh-config", "--file", path); err != nil {
+		t.Fatalf("ssh-config --file: %v", err)
+	}
+	got := readLog(t, path)
+	if !strings.Contains(got, "Host old "+stale) || !strings.Contains(got, "Host gaming "+testServerID) {
+		t.Fatalf("merge without --sync should keep the stale entry and add the new one:\n%v", got)
+	}
+
+	if _, err := runCommand(t, srv, "ssh-config", "--file", path, "--sync"); err != nil {
+		t.Fatalf("ssh-config --sync: %v", err)
+	}
+	got = readLog(t, path)
+	if strings.Contains(got, stale) {
+		t.Errorf("--sync kept the entry of a deleted server:\n%v", got)
+	}
+	if !strings.HasPrefix(got, "# my own host\nHost build\n") {
+		t.Errorf("--sync dropped lines it does not manage:\n%v", got)
+	}
+	if n := strings.Count(got, sshConfigBegin+testServerID); n != 1 {
+		t.Errorf("entry of %v written %v times:\n%v", testServerID, n, got)
+	}
+}
+
+func TestSSHAlias(t *testing.T) {
+	for name, want := range map[string]string{
+		"gaming":         "gaming",
+		"My Gaming Rig!": "my-gaming-rig",
+		"  steam.box  ":  "steam.box",
+		"":               "",
+	} {
+		if got := sshAlias(name); got != want {
+			t.Errorf("sshAlias(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
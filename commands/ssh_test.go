@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/raefon/td-stream/wolf"
+)
+
+func TestSSHBuiltinClient(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		if e.Command == "docker logs wolf-wolf-1" {
+			fmt.Fprintln(e.Stdout, "wolf is running")
+		}
+		return 0
+	})
+
+	out, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("wolf logs: %v", err)
+	}
+	if !strings.Contains(out, "wolf is running") {
+		t.Errorf("output = %q", out)
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf logs: %v", err)
+	}
+	if conns := sshSrv.Conns(); conns != 1 {
+		t.Errorf("connections = %v, want 1 shared by every command", conns)
+	}
+}
+
+func TestUploadFiles(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int { return 0 })
+
+	if _, err := runCommand(t, srv, "wolf", "install", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf install: %v", err)
+	}
+
+	want, _ := fs.ReadFile(wolf.Files, "docker-nvidia-start.sh")
+	if got, ok := sshSrv.File("/home/user/docker-nvidia-start.sh"); !ok || !bytes.Equal(got, want) {
+		t.Fatalf("uploaded script does not match the bundled one")
+	}
+	if cmds := sshSrv.Commands(); cmds[len(cmds)-1] != "bash /home/user/docker-nvidia-start.sh /home/user/docker-compose.nvidia.yml" {
+		t.Errorf("last command = %q", cmds[len(cmds)-1])
+	}
+
+	// Up to date files are not uploaded again, stale ones are.
+	sshSrv.SetFile("/home/user/docker-compose.nvidia.yml", []byte("image: old"))
+	before := len(sshSrv.Commands())
+	if _, err := runCommand(t, srv, "wolf", "install", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf install again: %v", err)
+	}
+	scp := 0
+	for _, c := range sshSrv.Commands()[before:] {
+		if strings.HasPrefix(c, "scp ") {
+			scp++
+		}
+	}
+	if scp != 1 {
+		t.Errorf("scp runs = %v, want 1", scp)
+	}
+	want, _ = fs.ReadFile(wolf.Files, "docker-compose.nvidia.yml")
+	if got, _ := sshSrv.File("/home/user/docker-compose.nvidia.yml"); !bytes.Equal(got, want) {
+		t.Errorf("stale compose file was not replaced")
+	}
+
+	before = len(sshSrv.Commands())
+	if _, err := runCommand(t, srv, "wolf", "install", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf install a third time: %v", err)
+	}
+	for _, c := range sshSrv.Commands()[before:] {
+		if strings.HasPrefix(c, "scp ") {
+			t.Errorf("up to date files were uploaded again")
+		}
+	}
+}
+
+func TestSSHBuiltinExitStatus(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int { return 7 })
+
+	_, err := runCommand(t, srv, "nvidia", "install", testServerID, "--keyPath", sshSrv.KeyPath)
+
+	var exitErr *remote.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Status != 7 {
+		t.Fatalf("err = %v, want exit status 7", err)
+	}
+}
+
+func TestHostKeyPinning(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int { return 0 })
+
+	if _, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf logs: %v", err)
+	}
+
+	out, err := runCommand(t, srv, "known-hosts", "list", "-o", "csv")
+	if err != nil {
+		t.Fatalf("known-hosts list: %v", err)
+	}
+	if !strings.Contains(out, testServerID+",ssh-ed25519,SHA256:") {
+		t.Errorf("known-hosts list = %q", out)
+	}
+
+	// Drop the pooled connection so the new key is seen.
+	sessions.Close()
+	sshSrv.RotateHostKey(t)
+	_, err = runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath)
+	var changed *remote.HostKeyChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("err = %v, want *HostKeyChangedError", err)
+	}
+
+	if _, err := runCommand(t, srv, "servers", "delete", testServerID); err != nil {
+		t.Fatalf("servers delete: %v", err)
+	}
+	if out, _ := runCommand(t, srv, "known-hosts", "list", "-o", "csv"); strings.Contains(out, testServerID) {
+		t.Errorf("host key kept after delete:\n%v", out)
+	}
+}
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    forward
+		wantErr bool
+	}{
+		{spec: "8080:localhost:80", want: forward{Listen: "localhost:8080", Target: "localhost:80"}},
+		{spec: "0.0.0.0:8080:10.0.0.1:80", want: forward{Listen: "0.0.0.0:8080", Target: "10.0.0.1:80"}},
+		{spec: "[::1]:8080:[::1]:80", want: forward{Listen: "[::1]:8080", Target: "[::1]:80"}},
+		{spec: "8080:[2001:db8::1]:80", want: forward{Listen: "localhost:8080", Target: "[2001:db8::1]:80"}},
+		{spec: "8080:80", wantErr: true},
+		{spec: "8080:::1:80", wantErr: true},
+		{spec: "[::1:8080:localhost:80", wantErr: true},
+		{spec: "x:localhost:80", wantErr: true},
+		{spec: "8080:localhost:70000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseForward(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseForward(%q) err = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseForward(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	for spec, want := range map[string]string{"1080": "localhost:1080", "0.0.0.0:1080": "0.0.0.0:1080", "[::1]:1080": "[::1]:1080"} {
+		if got, err := parseListen(spec); err != nil || got != want {
+			t.Errorf("parseListen(%q) = %q, %v, want %q", spec, got, err, want)
+		}
+	}
+	if _, err := parseListen("::1:1080"); err == nil {
+		t.Error("parseListen of an unbracketed IPv6 address: expected an error")
+	}
+}
+
+func TestSSHTunnelArgs(t *testing.T) {
+	srv := newTestServer(t)
+	bin, logPath := fakeSSH(t)
+
+	_, err := runCommand(t, srv, "ssh", testServerID, "-N", "-L", "8080:localhost:80", "-D", "1080",
+		"--stream-tunnel", "--bin", bin, "--keyPath", "/tmp/id_test")
+	if err != nil {
+		t.Fatalf("ssh: %v", err)
+	}
+
+	got := readLog(t, logPath)
+	for _, want := range []string{
+		"-L localhost:8080:localhost:80",
+		"-L localhost:47989:127.0.0.1:47989",
+		"-D localhost:1080",
+		"-N",
+		"-p 20022 user@203.0.113.10",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ssh args %q missing %q", got, want)
+		}
+	}
+}
+
+func TestVPNInstallStdin(t *testing.T) {
+	srv := newTestServer(t)
+	answers := make(chan string, 1)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		if strings.Contains(e.Command, "wireguard-install.sh") {
+			data, _ := io.ReadAll(e.Stdin)
+			answers <- string(data)
+		}
+		return 0
+	})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(w, "51820\nphone\n")
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+
+	if _, err := runCommand(t, srv, "vpn", "install", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("vpn install: %v", err)
+	}
+	if got := <-answers; got != "51820\nphone\n" {
+		t.Errorf("installer read %q, want the piped answers", got)
+	}
+}
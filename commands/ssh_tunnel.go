@@ -0,0 +1,305 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	sshCmd = &cobra.Command{
+		Use:   "ssh [flags] server_id [-- command]",
+		Short: "Open an SSH session with a server",
+		Long: `Open an SSH session with a server, optionally forwarding ports.
+
+--stream-tunnel forwards the TCP ports Moonlight uses to reach Wolf (47984,
+47989 and 48010) to the same ports on localhost, so pairing and app listing
+work from networks that block them. The video, audio and control streams use
+UDP, which SSH cannot carry; they still need the server's UDP ports or a VPN.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: sshSession,
+	}
+)
+
+// streamTunnelPorts are the Wolf TCP ports Moonlight connects to.
+var streamTunnelPorts = []int{47984, 47989, 48010}
+
+func init() {
+	addSSHFlags(sshCmd)
+	flags := sshCmd.Flags()
+	flags.StringArrayP("local-forward", "L", nil, "Forward a local port to the server, [bind_address:]port:host:hostport")
+	flags.StringArrayP("remote-forward", "R", nil, "Forward a port of the server to this machine, [bind_address:]port:host:hostport")
+	flags.StringP("socks", "D", "", "Run a SOCKS5 proxy through the server on [bind_address:]port")
+	flags.Bool("stream-tunnel", false, "Forward the Moonlight/Wolf TCP ports to localhost")
+	flags.BoolP("no-shell", "N", false, "Only forward ports, do not open a shell")
+	rootCmd.AddCommand(sshCmd)
+}
+
+// forward is a parsed -L or -R specification.
+type forward struct {
+	Listen string
+	Target string
+}
+
+// parseForward parses [bind_address:]port:host:hostport. The bind address
+// defaults to localhost, as with OpenSSH, and IPv6 addresses are written in
+// square brackets.
+func parseForward(spec string) (forward, error) {
+	parts, err := splitAddrs(spec)
+	if err != nil {
+		return forward{}, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	switch len(parts) {
+	case 3:
+		parts = append([]string{"localhost"}, parts...)
+	case 4:
+	default:
+		return forward{}, fmt.Errorf("invalid forward %q, want [bind_address:]port:host:hostport", spec)
+	}
+
+	for _, port := range []string{parts[1], parts[3]} {
+		if _, err := parsePort(port); err != nil {
+			return forward{}, fmt.Errorf("invalid forward %q: %w", spec, err)
+		}
+	}
+
+	return forward{
+		Listen: net.JoinHostPort(parts[0], parts[1]),
+		Target: net.JoinHostPort(parts[2], parts[3]),
+	}, nil
+}
+
+// parseListen parses [bind_address:]port.
+func parseListen(spec string) (string, error) {
+	parts, err := splitAddrs(spec)
+	if err != nil {
+		return "", err
+	}
+	switch len(parts) {
+	case 1:
+		parts = append([]string{"localhost"}, parts...)
+	case 2:
+	default:
+		return "", fmt.Errorf("invalid address %q, want [bind_address:]port", spec)
+	}
+
+	if _, err := parsePort(parts[1]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(parts[0], parts[1]), nil
+}
+
+// splitAddrs splits spec at the colons outside square brackets and strips
+// the brackets, like net.SplitHostPort does for one host and port.
+func splitAddrs(spec string) ([]string, error) {
+	var parts []string
+	for {
+		var part string
+		if strings.HasPrefix(spec, "[") {
+			end := strings.IndexByte(spec, ']')
+			if end < 0 {
+				return nil, errors.New("missing ']' in address")
+			}
+			part, spec = spec[1:end], spec[end+1:]
+			if spec != "" && spec[0] != ':' {
+				return nil, errors.New("unexpected text after ']' in address")
+			}
+		} else {
+			end := strings.IndexByte(spec, ':')
+			if end < 0 {
+				end = len(spec)
+			}
+			part, spec = spec[:end], spec[end:]
+		}
+
+		parts = append(parts, part)
+		if spec == "" {
+			return parts, nil
+		}
+		spec = spec[1:]
+	}
+}
+
+func parseForwards(specs []string) ([]forward, error) {
+	forwards := make([]forward, 0, len(specs))
+	for _, spec := range specs {
+		f, err := parseForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+// sshTunnels are the forwards requested on the ssh command line.
+type sshTunnels struct {
+	Local  []forward
+	Remote []forward
+	SOCKS  string
+}
+
+func tunnelsFromFlags(cmd *cobra.Command) (sshTunnels, error) {
+	flags := cmd.Flags()
+	var t sshTunnels
+
+	specs, err := flags.GetStringArray("local-forward")
+	if err != nil {
+		return t, err
+	}
+	if t.Local, err = parseForwards(specs); err != nil {
+		return t, err
+	}
+
+	if specs, err = flags.GetStringArray("remote-forward"); err != nil {
+		return t, err
+	}
+	if t.Remote, err = parseForwards(specs); err != nil {
+		return t, err
+	}
+
+	socks, err := flags.GetString("socks")
+	if err != nil {
+		return t, err
+	}
+	if socks != "" {
+		if t.SOCKS, err = parseListen(socks); err != nil {
+			return t, fmt.Errorf("invalid --socks: %w", err)
+		}
+	}
+
+	streamTunnel, err := flags.GetBool("stream-tunnel")
+	if err != nil {
+		return t, err
+	}
+	if streamTunnel {
+		for _, port := range streamTunnelPorts {
+			addr := net.JoinHostPort("localhost", fmt.Sprint(port))
+			t.Local = append(t.Local, forward{Listen: addr, Target: net.JoinHostPort("127.0.0.1", fmt.Sprint(port))})
+		}
+		log.Print("warning: Moonlight streams video, audio and input over UDP (47998-48000), which cannot be tunneled over SSH; those ports must still be reachable or go through a VPN")
+	}
+
+	return t, nil
+}
+
+// args returns the tunnels as OpenSSH options.
+func (t sshTunnels) args() []string {
+	var args []string
+	for _, f := range t.Local {
+		args = append(args, "-L", f.Listen+":"+f.Target)
+	}
+	for _, f := range t.Remote {
+		args = append(args, "-R", f.Listen+":"+f.Target)
+	}
+	if t.SOCKS != "" {
+		args = append(args, "-D", t.SOCKS)
+	}
+	return args
+}
+
+// start opens the tunnels over c until ctx is done.
+func (t sshTunnels) start(ctx context.Context, c *remote.Client) error {
+	for _, f := range t.Local {
+		addr, err := c.ForwardLocal(ctx, f.Listen, f.Target)
+		if err != nil {
+			return fmt.Errorf("forwarding %v: %w", f.Listen, err)
+		}
+		log.Printf("forwarding %v -> %v", addr, f.Target)
+	}
+	for _, f := range t.Remote {
+		addr, err := c.ForwardRemote(ctx, f.Listen, f.Target)
+		if err != nil {
+			return fmt.Errorf("forwarding remote %v: %w", f.Listen, err)
+		}
+		log.Printf("forwarding remote %v -> %v", addr, f.Target)
+	}
+	if t.SOCKS != "" {
+		addr, err := c.SOCKS(ctx, t.SOCKS)
+		if err != nil {
+			return fmt.Errorf("starting SOCKS proxy: %w", err)
+		}
+		log.Printf("SOCKS proxy on %v", addr)
+	}
+	return nil
+}
+
+func sshSession(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	server := args[0]
+
+	tunnels, err := tunnelsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	noShell, err := flags.GetBool("no-shell")
+	if err != nil {
+		return err
+	}
+
+	command, err := flags.GetString("command")
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		command = strings.Join(args[1:], " ")
+	}
+
+	bin, err := flags.GetString("bin")
+	if err != nil {
+		return err
+	}
+	if bin != "" {
+		user, err := flags.GetString("user")
+		if err != nil {
+			return err
+		}
+		keyPath, err := flags.GetString("keyPath")
+		if err != nil {
+			return err
+		}
+		if keyPath == "" {
+			keyPath = client.KeyPath
+		}
+
+		opts := tunnels.args()
+		if noShell {
+			opts = append(opts, "-N")
+		}
+		return executeSSHCommand(cmd.Context(), server, bin, user, keyPath, command, os.Stdin, os.Stdout, opts...)
+	}
+
+	c, err := sshClient(cmd, server)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	if err := tunnels.start(ctx, c); err != nil {
+		return err
+	}
+
+	if noShell {
+		log.Print("forwarding until interrupted")
+		<-ctx.Done()
+		return nil
+	}
+	// Like ssh -t, interactive sessions get a PTY so prompts and full
+	// screen programs behave. A command without a terminal only gets
+	// stdin when something is piped into it.
+	if command == "" || term.IsTerminal(int(os.Stdin.Fd())) {
+		return c.Shell(ctx, command, os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr())
+	}
+	return c.Run(ctx, command, pipedStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+}
@@ -1,13 +1,10 @@
 package commands
 
 import (
-	"errors"
 	"fmt"
-	"math/rand"
-	"os"
-	"time"
+	"sort"
 
-	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/raefon/td-stream/api"
 	"github.com/spf13/cobra"
 )
 
@@ -25,72 +22,156 @@ var (
 
 func init() {
 	listStockCmd.Flags().Bool("all", false, "Include out-of-stock instances")
+	addStockFilterFlags(listStockCmd)
+	listStockCmd.Flags().String("sort-by", "gpu_price", "Column to sort by, e.g. vram, uptime or tier")
+	listStockCmd.Flags().Bool("desc", false, "Sort in descending order")
+	listStockCmd.Flags().Int("limit", 0, "Show at most this many rows")
 	stockCmd.AddCommand(listStockCmd)
 	rootCmd.AddCommand(stockCmd)
 }
 
+// stockItem is one GPU model offered by a hostnode.
+type stockItem struct {
+	ID  string      `json:"hostnode"`
+	GPU api.GPUSpec `json:"gpu"`
+	api.HostNode
+}
+
+func asStock(item interface{}) stockItem {
+	return item.(stockItem)
+}
+
+// restriction returns the bounds of a single GPU server on the hostnode.
+func (item stockItem) restriction() api.Restriction {
+	r, _ := item.Specs.Restriction(1)
+	return r
+}
+
+var stockColumns = []column{
+	{Name: "HostNode ID", Value: func(i interface{}) interface{} { return asStock(i).ID }},
+	{Name: "GPU", Value: func(i interface{}) interface{} { return asStock(i).GPU.Name }},
+	{
+		Name:  "VRAM",
+		Value: func(i interface{}) interface{} { return fmt.Sprintf("%vGB", asStock(i).GPU.VRAM) },
+		Sort:  func(i interface{}) interface{} { return asStock(i).GPU.VRAM },
+	},
+	{Name: "Region", Value: func(i interface{}) interface{} { return asStock(i).Location.Region }},
+	{Name: "Available Units", Value: func(i interface{}) interface{} { return asStock(i).GPU.Amount }},
+	{Name: "GPU Price", Value: func(i interface{}) interface{} { return asStock(i).GPU.Price }},
+	{Name: "Location", Value: func(i interface{}) interface{} {
+		return fmt.Sprintf("%s, %s", asStock(i).Location.City, asStock(i).Location.Region)
+	}},
+	{
+		Name:  "Uptime",
+		Value: func(i interface{}) interface{} { return fmt.Sprintf("%.1f%%", asStock(i).Status.Uptime*100) },
+		Sort:  func(i interface{}) interface{} { return asStock(i).Status.Uptime },
+	},
+	{Name: "Tier", Value: func(i interface{}) interface{} { return asStock(i).Location.DC.Tier }},
+	{
+		Name:  "External Ports",
+		Value: func(i interface{}) interface{} { return samplePorts(asStock(i).Networking.Ports) },
+		Sort:  func(i interface{}) interface{} { return len(asStock(i).Networking.Ports) },
+	},
+	{Name: "Country", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Location.Country }},
+	{Name: "Datacenter", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Location.DC.Name }},
+	{Name: "Location ID", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Location.ID }},
+	{Name: "RTX", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).GPU.RTX }},
+	{Name: "GTX", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).GPU.GTX }},
+	{Name: "PCIe", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).GPU.PCIe }},
+	{Name: "CPU", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.CPU.Type }},
+	{Name: "vCPUs", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.CPU.Amount }},
+	{Name: "CPU Price", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.CPU.Price }},
+	{Name: "RAM", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.RAM.Amount }},
+	{Name: "RAM Price", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.RAM.Price }},
+	{Name: "Storage", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.Storage.Amount }},
+	{Name: "Storage Price", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Specs.Storage.Price }},
+	{Name: "vCPU Range", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).restriction().CPU.String() }},
+	{Name: "RAM Range", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).restriction().RAM.String() }},
+	{Name: "Storage Range", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).restriction().Storage.String() }},
+	{Name: "Send", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Networking.Send }},
+	{Name: "Receive", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Networking.Receive }},
+	{Name: "Online", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Status.Online }},
+	{Name: "Listed", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Status.Listed }},
+	{Name: "Reserved", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Status.Reserved }},
+	{Name: "Report", Wide: true, Value: func(i interface{}) interface{} { return asStock(i).Status.Report }},
+}
+
+// samplePorts shows the 10 lowest free ports of a hostnode.
+func samplePorts(ports []int) string {
+	if len(ports) == 0 {
+		return "No ports"
+	}
+
+	sample := append([]int(nil), ports...)
+	sort.Ints(sample)
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	return fmt.Sprintf("%v", sample)
+}
+
+// stockItems flattens the hostnodes into one item per GPU model, ordered
+// by hostnode and model so later stable sorts are deterministic.
+func stockItems(res *api.ListStockResponse, filter stockFilter) []stockItem {
+	var items []stockItem
+	for hostID, host := range res.HostNode {
+		for _, gpu := range host.Specs.GPU {
+			item := stockItem{ID: hostID, GPU: gpu, HostNode: host}
+			if filter.match(item) {
+				items = append(items, item)
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ID != items[j].ID {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].GPU.Name < items[j].GPU.Name
+	})
+	return items
+}
+
 func listStock(cmd *cobra.Command, args []string) error {
-	all, err := cmd.Flags().GetBool("all")
+	flags := cmd.Flags()
+
+	filter, err := stockFilterFromFlags(cmd)
 	if err != nil {
 		return err
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-
-	res, err := client.ListStock()
+	sortBy, err := flags.GetString("sort-by")
 	if err != nil {
 		return err
 	}
 
-	if !res.Success {
-		return errors.New(res.Error)
+	desc, err := flags.GetBool("desc")
+	if err != nil {
+		return err
 	}
 
-	t.AppendHeader(table.Row{"HostNode ID", "GPU", "Region", "Available Units", "GPU Price", "Location", "External Ports"})
+	limit, err := flags.GetInt("limit")
+	if err != nil {
+		return err
+	}
 
-	source := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(source)
+	res, err := client.ListStock(cmd.Context())
+	if err != nil {
+		return err
+	}
 
-	// Iterate over HostNode map
-	for hostID, host := range res.HostNode {
-		location := host.Location
-		region := location.Region
-		city := location.City
-		locationStr := fmt.Sprintf("%s, %s", city, region)
-		networking := host.Networking
-		ports := networking.Ports
-
-		// Sort ports to easily find min and max
-		var portsStr string
-		random.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
-		if len(ports) > 10 {
-			ports = ports[:10] // Slice the first 10 ports after shuffling
-		}
-		if len(ports) > 0 {
-			portsStr = fmt.Sprintf("%v", ports)
-		} else {
-			portsStr = "No ports"
-		}
+	v := view{Columns: stockColumns}
+	for _, item := range stockItems(res, filter) {
+		v.Items = append(v.Items, item)
+	}
 
-		specs := host.Specs
-		gpus := specs.GPU
-		for gpuName, gpuDetails := range gpus {
-			amount := gpuDetails.Amount
-			price := gpuDetails.Price
-			if amount > 0 || all {
-				t.AppendRow(table.Row{hostID, gpuName, region, amount, price, locationStr, portsStr})
-			}
-		}
+	if err := sortItems(v.Items, v.Columns, sortBy, desc); err != nil {
+		return err
 	}
 
-	// Sort
-	t.SortBy([]table.SortBy{
-		//{Name: "GPU", Mode: table.Asc},
-		//{Name: "Region", Mode: table.Asc},
-		{Name: "GPU Price", Mode: table.Asc},
-	})
+	if limit > 0 && len(v.Items) > limit {
+		v.Items = v.Items[:limit]
+	}
 
-	t.Render()
-	return nil
+	return render(cmd, v)
 }
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// continents maps the region names accepted by --region to the countries
+// the marketplace reports, so "north america" matches US and Canadian hosts.
+var continents = map[string][]string{
+	"north america": {"United States", "Canada", "Mexico"},
+	"south america": {"Brazil", "Argentina", "Chile", "Colombia", "Peru"},
+	"europe": {
+		"Austria", "Belgium", "Bulgaria", "Czech Republic", "Czechia", "Denmark",
+		"Estonia", "Finland", "France", "Germany", "Hungary", "Iceland", "Ireland",
+		"Italy", "Latvia", "Lithuania", "Luxembourg", "Netherlands", "Norway",
+		"Poland", "Portugal", "Romania", "Slovakia", "Spain", "Sweden",
+		"Switzerland", "Ukraine", "United Kingdom",
+	},
+	"asia": {
+		"China", "Hong Kong", "India", "Indonesia", "Israel", "Japan", "Malaysia",
+		"Philippines", "Singapore", "South Korea", "Taiwan", "Thailand",
+		"United Arab Emirates", "Vietnam",
+	},
+	"oceania": {"Australia", "New Zealand"},
+	"africa":  {"Egypt", "Kenya", "Nigeria", "South Africa"},
+}
+
+// stockFilter selects stock items from the marketplace.
+type stockFilter struct {
+	All        bool
+	GPU        *regexp.Regexp
+	MinVRAM    int
+	RTXOnly    bool
+	Region     string
+	Country    string
+	City       string
+	MinUptime  float64
+	MinGPUs    int
+	MaxPrice   float64
+	OnlineOnly bool
+	MinTier    int
+}
+
+func addStockFilterFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.String("gpu", "", "GPU model substring or regular expression, e.g. 4090 or 'rtx(3090|4090)'")
+	flags.Int("min-vram", 0, "Minimum GPU memory in GB")
+	flags.Bool("rtx-only", false, "Only RTX GPUs")
+	flags.String("region", "", "Region, state or continent, e.g. 'north america'")
+	flags.String("country", "", "Country substring")
+	flags.String("city", "", "City substring")
+	flags.Float64("min-uptime", 0, "Minimum hostnode uptime in percent, e.g. 99.5")
+	flags.Int("min-gpus", 0, "Minimum number of available GPUs")
+	flags.Float64("max-price", 0, "Maximum hourly price of a single GPU")
+	flags.Bool("online-only", false, "Only online hostnodes")
+	flags.Int("min-tier", 0, "Minimum datacenter tier")
+}
+
+func stockFilterFromFlags(cmd *cobra.Command) (stockFilter, error) {
+	flags := cmd.Flags()
+	var filter stockFilter
+
+	// Commands that only list in-stock items do not define --all.
+	if flags.Lookup("all") != nil {
+		all, err := flags.GetBool("all")
+		if err != nil {
+			return filter, err
+		}
+		filter.All = all
+	}
+
+	gpu, err := flags.GetString("gpu")
+	if err != nil {
+		return filter, err
+	}
+	if gpu != "" {
+		filter.GPU, err = regexp.Compile("(?i)" + gpu)
+		if err != nil {
+			filter.GPU = regexp.MustCompile("(?i)" + regexp.QuoteMeta(gpu))
+		}
+	}
+
+	if filter.MinVRAM, err = flags.GetInt("min-vram"); err != nil {
+		return filter, err
+	}
+	if filter.RTXOnly, err = flags.GetBool("rtx-only"); err != nil {
+		return filter, err
+	}
+	if filter.Region, err = flags.GetString("region"); err != nil {
+		return filter, err
+	}
+	if filter.Country, err = flags.GetString("country"); err != nil {
+		return filter, err
+	}
+	if filter.City, err = flags.GetString("city"); err != nil {
+		return filter, err
+	}
+	if filter.MinUptime, err = flags.GetFloat64("min-uptime"); err != nil {
+		return filter, err
+	}
+	if filter.MinUptime < 0 || filter.MinUptime > 100 {
+		return filter, fmt.Errorf("--min-uptime must be a percentage between 0 and 100")
+	}
+	if filter.MinGPUs, err = flags.GetInt("min-gpus"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = flags.GetFloat64("max-price"); err != nil {
+		return filter, err
+	}
+	if filter.OnlineOnly, err = flags.GetBool("online-only"); err != nil {
+		return filter, err
+	}
+	if filter.MinTier, err = flags.GetInt("min-tier"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func (filter stockFilter) match(item stockItem) bool {
+	switch {
+	case !filter.All && item.GPU.Amount <= 0:
+		return false
+	case filter.GPU != nil && !filter.GPU.MatchString(item.GPU.Name):
+		return false
+	case item.GPU.VRAM < filter.MinVRAM:
+		return false
+	case filter.RTXOnly && !item.GPU.RTX:
+		return false
+	case filter.Region != "" && !matchRegion(filter.Region, item.Location.Region, item.Location.Country):
+		return false
+	case !containsFold(item.Location.Country, filter.Country):
+		return false
+	case !containsFold(item.Location.City, filter.City):
+		return false
+	case item.Status.Uptime*100 < filter.MinUptime:
+		return false
+	case item.GPU.Amount < filter.MinGPUs:
+		return false
+	case filter.MaxPrice > 0 && item.GPU.Price > filter.MaxPrice:
+		return false
+	case filter.OnlineOnly && !item.Status.Online:
+		return false
+	case item.Location.DC.Tier < filter.MinTier:
+		return false
+	}
+	return true
+}
+
+func matchRegion(region, hostRegion, hostCountry string) bool {
+	if containsFold(hostRegion, region) {
+		return true
+	}
+
+	for _, country := range continents[strings.ToLower(strings.TrimSpace(region))] {
+		if strings.EqualFold(country, hostCountry) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
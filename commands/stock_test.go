@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStockListFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "cheapest 24GB in north america",
+			args: []string{"--min-vram", "24", "--region", "north america", "--limit", "1"},
+			want: "geforcertx4090-pcie-24gb,Idaho",
+		},
+		{
+			name: "gpu regex sorted by price descending",
+			args: []string{"--gpu", "4090|a6000", "--sort-by", "gpu_price", "--desc"},
+			want: "rtxa6000-pcie-48gb,Idaho\ngeforcertx4090-pcie-24gb,Hesse\ngeforcertx4090-pcie-24gb,Idaho",
+		},
+		{
+			name: "online and uptime",
+			args: []string{"--online-only", "--min-uptime", "99"},
+			want: "geforcertx4090-pcie-24gb,Idaho\nrtxa6000-pcie-48gb,Idaho",
+		},
+		{
+			name: "tier and country",
+			args: []string{"--min-tier", "4", "--country", "germany"},
+			want: "geforcertx4090-pcie-24gb,Hesse",
+		},
+		{
+			name: "max price and min gpus",
+			args: []string{"--max-price", "0.45", "--min-gpus", "3"},
+			want: "geforcertx4090-pcie-24gb,Idaho",
+		},
+		{
+			name: "out of stock with all",
+			args: []string{"--all", "--city", "southfield", "--rtx-only"},
+			want: "geforcertx3060-pcie-12gb,Michigan",
+		},
+		{
+			name: "sort by uptime",
+			args: []string{"--all", "--gpu", "4090|3060", "--sort-by", "uptime"},
+			want: "geforcertx4090-pcie-24gb,Hesse\ngeforcertx4090-pcie-24gb,Idaho\ngeforcertx3060-pcie-12gb,Michigan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+
+			args := append([]string{"stock", "list", "-o", "csv", "--columns", "gpu,region"}, tt.args...)
+			out, err := runCommand(t, srv, args...)
+			if err != nil {
+				t.Fatalf("stock list: %v", err)
+			}
+
+			got := strings.TrimSpace(strings.TrimPrefix(out, "gpu,region\n"))
+			if got != tt.want {
+				t.Errorf("got:\n%v\nwant:\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStockListUnknownSortColumn(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := runCommand(t, srv, "stock", "list", "--sort-by", "nope"); err == nil {
+		t.Fatal("expected an error for an unknown sort column")
+	}
+}
+
+func TestSamplePorts(t *testing.T) {
+	ports := []int{20022, 20001, 20015, 20003, 20011, 20005, 20010, 20007, 20013, 20009, 20002, 20004}
+	want := "[20001 20002 20003 20004 20005 20007 20009 20010 20011 20013]"
+	for i := 0; i < 3; i++ {
+		if got := samplePorts(ports); got != want {
+			t.Fatalf("samplePorts = %v, want %v", got, want)
+		}
+	}
+	if ports[0] != 20022 {
+		t.Error("samplePorts sorted its argument")
+	}
+}
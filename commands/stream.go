@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	streamCmd = &cobra.Command{
+		Use:   "stream server_id [app]",
+		Short: "Start a Moonlight session with a server",
+		Long: `Start a Moonlight session with a server: check that Wolf is up and launch
+moonlight (or moonlight-qt) against the server's Wolf port.
+
+Settings are read from the stream section of the config file, optionally
+overridden by a named profile under stream.profiles and then by flags:
+
+  stream:
+    resolution: 1920x1080
+    fps: 60
+    bitrate: 20000
+    app: Steam
+    options: ["--game-optimization"]
+    profiles:
+      4k:
+        resolution: 3840x2160
+        bitrate: 80000`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: streamServer,
+	}
+)
+
+func init() {
+	flags := streamCmd.Flags()
+	flags.String("profile", "", "Stream profile from the config file")
+	flags.String("resolution", "", "Resolution, e.g. 1920x1080")
+	flags.Int("fps", 0, "Frames per second")
+	flags.Int("bitrate", 0, "Bitrate in Kbps")
+	flags.String("moonlight", "", "Moonlight executable (default: moonlight or moonlight-qt from PATH)")
+	flags.Bool("dry-run", false, "Print the Moonlight command instead of running it")
+	addRemoteFlags(streamCmd)
+	rootCmd.AddCommand(streamCmd)
+}
+
+// streamProfile holds the Moonlight settings of a session.
+type streamProfile struct {
+	Moonlight  string   `mapstructure:"moonlight"`
+	App        string   `mapstructure:"app"`
+	Resolution string   `mapstructure:"resolution"`
+	FPS        int      `mapstructure:"fps"`
+	Bitrate    int      `mapstructure:"bitrate"`
+	Options    []string `mapstructure:"options"`
+}
+
+var defaultStreamProfile = streamProfile{
+	Resolution: "1920x1080",
+	FPS:        60,
+	Bitrate:    20000,
+}
+
+var resolutionFormat = regexp.MustCompile(`^\d+x\d+$`)
+
+// loadStreamProfile reads the stream settings from the config file and
+// overlays the named profile.
+func loadStreamProfile(name string) (streamProfile, error) {
+	p := defaultStreamProfile
+	if err := viper.UnmarshalKey("stream", &p); err != nil {
+		return p, fmt.Errorf("reading stream settings: %w", err)
+	}
+	if name != "" {
+		key := "stream.profiles." + name
+		if !viper.IsSet(key) {
+			return p, fmt.Errorf("no stream profile %q in %v", name, viper.ConfigFileUsed())
+		}
+		if err := viper.UnmarshalKey(key, &p); err != nil {
+			return p, fmt.Errorf("reading stream profile %v: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// streamProfileFromFlags loads the profile and applies the flags of cmd.
+func streamProfileFromFlags(cmd *cobra.Command) (streamProfile, error) {
+	flags := cmd.Flags()
+
+	name, err := flags.GetString("profile")
+	if err != nil {
+		return streamProfile{}, err
+	}
+	p, err := loadStreamProfile(name)
+	if err != nil {
+		return p, err
+	}
+
+	for flag, field := range map[string]*string{"resolution": &p.Resolution, "moonlight": &p.Moonlight} {
+		if flags.Changed(flag) {
+			if *field, err = flags.GetString(flag); err != nil {
+				return p, err
+			}
+		}
+	}
+	for flag, field := range map[string]*int{"fps": &p.FPS, "bitrate": &p.Bitrate} {
+		if flags.Changed(flag) {
+			if *field, err = flags.GetInt(flag); err != nil {
+				return p, err
+			}
+		}
+	}
+
+	switch {
+	case !resolutionFormat.MatchString(p.Resolution):
+		return p, fmt.Errorf("invalid resolution %q, want WIDTHxHEIGHT", p.Resolution)
+	case p.FPS <= 0:
+		return p, fmt.Errorf("fps must be positive, got %v", p.FPS)
+	case p.Bitrate <= 0:
+		return p, fmt.Errorf("bitrate must be positive, got %v", p.Bitrate)
+	}
+	return p, nil
+}
+
+// moonlightBinary finds the Moonlight executable.
+func moonlightBinary(p streamProfile) (string, error) {
+	if p.Moonlight != "" {
+		return p.Moonlight, nil
+	}
+	for _, name := range []string{"moonlight", "moonlight-qt"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("moonlight not found in PATH, install Moonlight or set --moonlight")
+}
+
+// moonlightArgs returns the arguments of `moonlight stream`.
+func moonlightArgs(p streamProfile, address, app string) []string {
+	args := []string{"stream", address, app,
+		"--resolution", p.Resolution,
+		"--fps", strconv.Itoa(p.FPS),
+		"--bitrate", strconv.Itoa(p.Bitrate),
+	}
+	return append(args, p.Options...)
+}
+
+func streamServer(cmd *cobra.Command, args []string) error {
+	serverId := args[0]
+
+	p, err := streamProfileFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		p.App = args[1]
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	address, _, err := wolfAddresses(cmd, serverId)
+	if err != nil {
+		return err
+	}
+
+	c, err := sshClient(cmd, serverId)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.Output(cmd.Context(), "docker inspect -f '{{.State.Running}}' "+wolfContainer)
+	if err != nil || strings.TrimSpace(string(res.Stdout)) != "true" {
+		return fmt.Errorf("wolf is not running on %v, start it with `td-stream wolf install %v`", serverId, serverId)
+	}
+
+	// Resolve the app against the Wolf config so a typo fails here rather
+	// than in Moonlight, and pick the first app when none is given.
+	doc, _, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Apps) == 0 {
+		return fmt.Errorf("wolf on %v has no apps, add one with `td-stream wolf apps add`", serverId)
+	}
+	app := cfg.Apps[0].Title
+	if p.App != "" {
+		i, err := doc.FindApp(p.App)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			titles := make([]string, 0, len(cfg.Apps))
+			for _, a := range cfg.Apps {
+				titles = append(titles, a.Title)
+			}
+			return fmt.Errorf("no app %q on %v, available apps: %v", p.App, serverId, strings.Join(titles, ", "))
+		}
+		app = cfg.Apps[i].Title
+	}
+
+	bin, err := moonlightBinary(p)
+	if err != nil {
+		return err
+	}
+	moonlightArgs := moonlightArgs(p, address, app)
+
+	if dryRun {
+		quoted := []string{remote.Quote(bin)}
+		for _, arg := range moonlightArgs {
+			quoted = append(quoted, remote.Quote(arg))
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), strings.Join(quoted, " "))
+		return nil
+	}
+
+	log.Printf("streaming %v from %v at %v, %v fps, %v Kbps", app, address, p.Resolution, p.FPS, p.Bitrate)
+	moonlight := exec.CommandContext(cmd.Context(), bin, moonlightArgs...)
+	moonlight.Stdin = os.Stdin
+	moonlight.Stdout = cmd.OutOrStdout()
+	moonlight.Stderr = cmd.ErrOrStderr()
+	return moonlight.Run()
+}
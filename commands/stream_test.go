@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/spf13/viper"
+)
+
+func TestStream(t *testing.T) {
+	srv := newTestServer(t)
+	host := &wolfHost{config: testWolfConfig}
+	running := "true"
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		if e.Command == "docker inspect -f '{{.State.Running}}' wolf-wolf-1" {
+			io.WriteString(e.Stdout, running+"\n")
+			return 0
+		}
+		return host.handle(e)
+	})
+	vm, _ := srv.VM(testServerID)
+	vm.PortForwards["20089"] = "47989"
+	srv.AddServer(testServerID, vm)
+
+	bin, logPath := fakeSSH(t)
+	if _, err := runCommand(t, srv, "stream", testServerID, "firefox", "--fps", "120", "--moonlight", bin, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	want := "stream 127.0.0.1:20089 Firefox --resolution 1920x1080 --fps 120 --bitrate 20000"
+	if got := strings.TrimSpace(readLog(t, logPath)); got != want {
+		t.Errorf("moonlight args = %q, want %q", got, want)
+	}
+
+	out, err := runCommand(t, srv, "stream", testServerID, "firefox", "--dry-run", "--moonlight", bin, "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("stream --dry-run: %v", err)
+	}
+	want = "'" + bin + "' 'stream' '127.0.0.1:20089' 'Firefox' '--resolution' '1920x1080' '--fps' '60' '--bitrate' '20000'\n"
+	if out != want {
+		t.Errorf("stream --dry-run = %q, want %q", out, want)
+	}
+
+	_, err = runCommand(t, srv, "stream", testServerID, "doom", "--moonlight", bin, "--keyPath", sshSrv.KeyPath)
+	if err == nil || !strings.Contains(err.Error(), "available apps: Firefox") {
+		t.Errorf("unknown app err = %v", err)
+	}
+
+	running = "false"
+	_, err = runCommand(t, srv, "stream", testServerID, "--moonlight", bin, "--keyPath", sshSrv.KeyPath)
+	if err == nil || !strings.Contains(err.Error(), "wolf is not running") {
+		t.Errorf("stopped wolf err = %v", err)
+	}
+}
+
+func TestLoadStreamProfile(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("stream.fps", 90)
+	viper.Set("stream.profiles.4k.resolution", "3840x2160")
+	viper.Set("stream.profiles.4k.bitrate", 80000)
+
+	p, err := loadStreamProfile("4k")
+	if err != nil {
+		t.Fatalf("loadStreamProfile: %v", err)
+	}
+	want := streamProfile{Resolution: "3840x2160", FPS: 90, Bitrate: 80000}
+	if p.Resolution != want.Resolution || p.FPS != want.FPS || p.Bitrate != want.Bitrate {
+		t.Errorf("profile = %+v, want %+v", p, want)
+	}
+
+	if _, err := loadStreamProfile("missing"); err == nil {
+		t.Error("missing profile accepted")
+	}
+}
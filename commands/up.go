@@ -0,0 +1,286 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upCmd = &cobra.Command{
+		Use:   "up [flags] name [password]",
+		Short: "Deploy a server and install everything needed to stream from it",
+		Long: `Deploy a server and install everything needed to stream from it.
+
+The steps are deploy, wait-deploy, nvidia, wait-nvidia, setup, wait-setup, wolf
+and vpn. Progress is saved after every step, so running the same command again
+resumes at the step that failed. The password is only needed for the deploy
+step.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: up,
+	}
+)
+
+func init() {
+	addDeployFlags(upCmd, "wolf", true)
+	addRemoteFlags(upCmd)
+	flags := upCmd.Flags()
+	flags.String("bin", "", "Run this SSH client executable (e.g., ssh, mosh) instead of the built-in client")
+	flags.String("server", "", "Adopt an existing server instead of deploying one")
+	flags.StringSlice("skip", nil, "Steps to skip")
+	flags.StringSlice("only", nil, "Only run these steps, even if they already completed")
+	flags.Duration("wait-timeout", 20*time.Minute, "How long to wait for the server after each step")
+	flags.Duration("reboot-grace", 30*time.Second, "How long to give the server to go down after a step reboots it")
+	rootCmd.AddCommand(upCmd)
+}
+
+// upState is the progress of `up` for one server, saved in up/<name>.json.
+type upState struct {
+	Name      string    `json:"name"`
+	ServerID  string    `json:"server_id,omitempty"`
+	Completed []string  `json:"completed"`
+	Failed    string    `json:"failed,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+func upStateName(name string) string {
+	return "up/" + name + ".json"
+}
+
+func (s *upState) done(step string) bool {
+	return slices.Contains(s.Completed, step)
+}
+
+func (s *upState) save() error {
+	s.Updated = time.Now().UTC()
+	return state.Save(upStateName(s.Name), s)
+}
+
+// upStep is one stage of the pipeline.
+type upStep struct {
+	Name string
+	Run  func(cmd *cobra.Command, args []string, s *upState) error
+}
+
+var upSteps = []upStep{
+	{"deploy", upDeploy},
+	{"wait-deploy", upWait(false)},
+	{"nvidia", upReboot(nvidiaInstall, nvidiaRebootMarker)},
+	{"wait-nvidia", upWait(true)},
+	{"setup", upReboot(setupServerCmd, setupRebootMarker)},
+	{"wait-setup", upWait(true)},
+	{"wolf", upRun(wolfInstall)},
+	{"vpn", upRun(vpnInstall)},
+}
+
+func upDeploy(cmd *cobra.Command, args []string, s *upState) error {
+	if s.ServerID != "" {
+		log.Printf("server %v already deployed", s.ServerID)
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("a password is required to deploy %v", s.Name)
+	}
+
+	id, err := runDeploy(cmd, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	s.ServerID = id
+	return nil
+}
+
+func upWait(afterReboot bool) func(*cobra.Command, []string, *upState) error {
+	return func(cmd *cobra.Command, args []string, s *upState) error {
+		if afterReboot {
+			grace, err := cmd.Flags().GetDuration("reboot-grace")
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-cmd.Context().Done():
+				return cmd.Context().Err()
+			case <-time.After(grace):
+			}
+		}
+		return waitForServer(cmd, s.ServerID, statusSSHReady)
+	}
+}
+
+func upRun(fn func(*cobra.Command, string) error) func(*cobra.Command, []string, *upState) error {
+	return func(cmd *cobra.Command, args []string, s *upState) error {
+		return fn(cmd, s.ServerID)
+	}
+}
+
+// upReboot runs a step that ends by rebooting the server. The SSH session
+// is cut by the reboot, which ssh reports with exit status 255; that only
+// counts as success once the step printed marker, so a connection lost
+// halfway through the install fails the step.
+func upReboot(fn func(*cobra.Command, string) error, marker string) func(*cobra.Command, []string, *upState) error {
+	return func(cmd *cobra.Command, args []string, s *upState) error {
+		out := &markerWriter{w: cmd.OutOrStdout(), marker: []byte(marker)}
+		// up never has an output of its own, clearing it hands the output
+		// back to the root command.
+		cmd.SetOut(out)
+		defer cmd.SetOut(nil)
+
+		err := fn(cmd, s.ServerID)
+
+		var exitErr *exec.ExitError
+		if errors.Is(err, remote.ErrDisconnected) || errors.As(err, &exitErr) && exitErr.ExitCode() == 255 {
+			if !out.seen {
+				return fmt.Errorf("connection lost before the server started rebooting: %w", err)
+			}
+			log.Print("connection closed by the reboot")
+			return nil
+		}
+		return err
+	}
+}
+
+// markerWriter passes writes through to w and records whether marker went
+// by, even when it is split across writes.
+type markerWriter struct {
+	w      io.Writer
+	marker []byte
+	tail   []byte
+	seen   bool
+}
+
+func (m *markerWriter) Write(p []byte) (int, error) {
+	if !m.seen {
+		buf := append(m.tail, p...)
+		m.seen = bytes.Contains(buf, m.marker)
+		if keep := len(m.marker) - 1; len(buf) > keep {
+			buf = buf[len(buf)-keep:]
+		}
+		m.tail = append([]byte(nil), buf...)
+	}
+	return m.w.Write(p)
+}
+
+func upStepNames() []string {
+	names := make([]string, len(upSteps))
+	for i, step := range upSteps {
+		names[i] = step.Name
+	}
+	return names
+}
+
+func checkStepNames(flag string, names []string) error {
+	for _, name := range names {
+		if !slices.Contains(upStepNames(), name) {
+			return fmt.Errorf("--%v: unknown step %q, want one of %v", flag, name, strings.Join(upStepNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// checkFileName rejects names that cannot be used in a file name.
+func checkFileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid name %q, it cannot contain path separators or be . or ..", name)
+	}
+	return nil
+}
+
+func up(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	name := args[0]
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+
+	skip, err := flags.GetStringSlice("skip")
+	if err != nil {
+		return err
+	}
+	if err := checkStepNames("skip", skip); err != nil {
+		return err
+	}
+
+	only, err := flags.GetStringSlice("only")
+	if err != nil {
+		return err
+	}
+	if err := checkStepNames("only", only); err != nil {
+		return err
+	}
+
+	server, err := flags.GetString("server")
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := flags.GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		_, err := runDeploy(cmd, name, "")
+		return err
+	}
+
+	s := upState{Name: name}
+	if err := state.Load(upStateName(name), &s); err != nil {
+		return err
+	}
+
+	if server != "" {
+		if s.ServerID != "" && s.ServerID != server {
+			return fmt.Errorf("%v is already provisioning server %v", name, s.ServerID)
+		}
+		s.ServerID = server
+		if !s.done("deploy") {
+			s.Completed = append(s.Completed, "deploy")
+		}
+	}
+
+	for _, step := range upSteps {
+		if len(only) > 0 && !slices.Contains(only, step.Name) || slices.Contains(skip, step.Name) {
+			continue
+		}
+		if len(only) == 0 && s.done(step.Name) {
+			log.Printf("%v: already done", step.Name)
+			continue
+		}
+		if step.Name != "deploy" && s.ServerID == "" {
+			return fmt.Errorf("no server recorded for %v, run the deploy step or pass --server", name)
+		}
+
+		log.Printf("%v: running", step.Name)
+		if err := step.Run(cmd, args, &s); err != nil {
+			s.Failed = step.Name
+			s.Error = err.Error()
+			if saveErr := s.save(); saveErr != nil {
+				log.Printf("saving progress: %v", saveErr)
+			}
+			return fmt.Errorf("step %v failed, rerun up to resume: %w", step.Name, err)
+		}
+
+		if !s.done(step.Name) {
+			s.Completed = append(s.Completed, step.Name)
+		}
+		s.Failed = ""
+		s.Error = ""
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), s.ServerID)
+	return nil
+}
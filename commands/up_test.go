@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/state"
+)
+
+// failingSSH writes an ssh stand-in that logs its arguments and fails when
+// they contain match.
+func failingSSH(t *testing.T, match string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "ssh.log")
+	bin := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %v\ncase \"$*\" in *%v*) exit 1;; esac\n", logPath, match)
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, logPath
+}
+
+func TestUpResume(t *testing.T) {
+	srv := newTestServer(t)
+	skipWaits := "--skip=wait-deploy,wait-nvidia,wait-setup"
+
+	bin, logPath := failingSSH(t, "setup.sh")
+	_, err := runCommand(t, srv, "up", "box", "secret", "--auto", "--bin", bin, skipWaits)
+	if err == nil || !strings.Contains(err.Error(), "step setup failed") {
+		t.Fatalf("up: err = %v, want setup failure", err)
+	}
+	if sshLog := readLog(t, logPath); !strings.Contains(sshLog, "nvidia-driver-535") {
+		t.Errorf("nvidia step did not run:\n%v", sshLog)
+	}
+
+	var s upState
+	if err := state.Load(upStateName("box"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ServerID == "" || s.Failed != "setup" || strings.Join(s.Completed, ",") != "deploy,nvidia" {
+		t.Fatalf("state = %+v", s)
+	}
+
+	vm, ok := srv.VM(s.ServerID)
+	if !ok {
+		t.Fatalf("server %v not deployed", s.ServerID)
+	}
+	if len(vm.PortForwards) != 7 {
+		t.Errorf("port forwards = %v, want the wolf preset", vm.PortForwards)
+	}
+
+	bin, logPath = fakeSSH(t)
+	out, err := runCommand(t, srv, "up", "box", "--bin", bin, skipWaits)
+	if err != nil {
+		t.Fatalf("up resume: %v", err)
+	}
+	if strings.TrimSpace(out) != s.ServerID {
+		t.Errorf("output = %q, want %v", out, s.ServerID)
+	}
+
+	sshLog := readLog(t, logPath)
+	if strings.Contains(sshLog, "nvidia-driver-535") {
+		t.Errorf("resume reran the nvidia step:\n%v", sshLog)
+	}
+	for _, want := range []string{"setup.sh", "docker-nvidia-start.sh", "wireguard-install.sh"} {
+		if !strings.Contains(sshLog, want) {
+			t.Errorf("resume did not run %v:\n%v", want, sshLog)
+		}
+	}
+	if calls := srv.Calls("deploy/single"); calls != 1 {
+		t.Errorf("deploy/single calls = %v, want 1", calls)
+	}
+}
+
+func TestUpOnly(t *testing.T) {
+	srv := newTestServer(t)
+	bin, logPath := fakeSSH(t)
+
+	if _, err := runCommand(t, srv, "up", "gaming", "--server", testServerID, "--only", "wolf", "--bin", bin); err != nil {
+		t.Fatalf("up --only wolf: %v", err)
+	}
+
+	sshLog := readLog(t, logPath)
+	if !strings.Contains(sshLog, "docker-nvidia-start.sh") || strings.Contains(sshLog, "nvidia-driver-535") {
+		t.Errorf("--only wolf ran:\n%v", sshLog)
+	}
+	if srv.Calls("deploy/single") != 0 {
+		t.Error("--server still deployed")
+	}
+
+	if _, err := runCommand(t, srv, "up", "gaming", "--only", "reboot"); err == nil {
+		t.Error("unknown step: expected an error")
+	}
+}
+
+func TestUpInvalidName(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, name := range []string{"../../x", "a/b", ".."} {
+		if _, err := runCommand(t, srv, "up", name, "secret", "--server", testServerID); err == nil {
+			t.Errorf("up %q: expected an error", name)
+		}
+	}
+	if calls := srv.Calls("deploy/single"); calls != 0 {
+		t.Errorf("deployed %v servers for invalid names", calls)
+	}
+}
+
+// disconnectingSSH writes an ssh stand-in that prints output and then drops
+// the connection like a reboot does.
+func disconnectingSSH(t *testing.T, output string) string {
+	t.Helper()
+
+	bin := filepath.Join(t.TempDir(), "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho '%v'\nexit 255\n", output)
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestUpRebootMarker(t *testing.T) {
+	srv := newTestServer(t)
+
+	bin := disconnectingSSH(t, "Setting up nvidia-driver-535")
+	_, err := runCommand(t, srv, "up", "box", "--server", testServerID, "--only", "nvidia", "--bin", bin)
+	if err == nil || !strings.Contains(err.Error(), "connection lost before the server started rebooting") {
+		t.Fatalf("disconnect before the reboot: err = %v", err)
+	}
+
+	bin = disconnectingSSH(t, nvidiaRebootMarker)
+	if _, err := runCommand(t, srv, "up", "box", "--server", testServerID, "--only", "nvidia", "--bin", bin); err != nil {
+		t.Fatalf("disconnect by the reboot: %v", err)
+	}
+
+	var s upState
+	if err := state.Load(upStateName("box"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.done("nvidia") || s.Failed != "" {
+		t.Errorf("state = %+v, want nvidia completed", s)
+	}
+}
@@ -16,16 +16,13 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			serverID := args[0]
 
-			cmd.Flags().String("bin", "ssh", "Name of SSH client executable (e.g., ssh, mosh)")
-			cmd.Flags().String("user", "user", "User account to use for login")
-			cmd.Flags().String("command", "", "Command to execute over SSH")
-
 			return vpnInstall(cmd, serverID)
 		},
 	}
 )
 
 func init() {
+	addSSHFlags(vpnInstallCmd)
 	vpnCmd.AddCommand(vpnInstallCmd)
 	rootCmd.AddCommand(vpnCmd)
 }
@@ -34,9 +31,6 @@ func vpnInstall(cmd *cobra.Command, server string) error {
 
 	startScriptCommand := "wget https://git.io/wireguard -O wireguard-install.sh && sudo bash wireguard-install.sh"
 
-	// Set the command to be executed over SSH
-	cmd.Flags().Set("command", startScriptCommand)
-
-	// Execute the SSH command to run the script
-	return sshServer(cmd, []string{server})
+	// The installer asks for the port, DNS and client name.
+	return runInteractive(cmd, server, startScriptCommand)
 }
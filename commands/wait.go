@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/spf13/cobra"
+)
+
+// statusSSHReady is the wait target for a running server whose SSH daemon
+// answers on its forwarded port.
+const statusSSHReady = "ssh-ready"
+
+var (
+	waitCmd = &cobra.Command{
+		Use:   "wait [flags] server_id",
+		Short: "Wait until a server reaches a state",
+		Args:  cobra.ExactArgs(1),
+		RunE:  waitServer,
+	}
+)
+
+func init() {
+	waitCmd.Flags().String("for", "running", "State to wait for: running, stopped, deleted or ssh-ready")
+	waitCmd.Flags().Duration("wait-timeout", api.DefaultWaitOptions.Timeout, "How long to wait before giving up")
+	serversCmd.AddCommand(waitCmd)
+
+	for _, cmd := range []*cobra.Command{startCmd, stopCmd, restartCmd, deleteCmd, deployCmd, modifyCmd} {
+		addWaitFlags(cmd)
+	}
+}
+
+// addWaitFlags registers --wait on a lifecycle command.
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("wait", false, "Wait until the server reaches its new state")
+	cmd.Flags().Duration("wait-timeout", api.DefaultWaitOptions.Timeout, "How long --wait waits before giving up")
+}
+
+func waitServer(cmd *cobra.Command, args []string) error {
+	target, err := cmd.Flags().GetString("for")
+	if err != nil {
+		return err
+	}
+
+	switch target {
+	case "running", "stopped", api.StatusDeleted, statusSSHReady:
+	default:
+		return fmt.Errorf("unknown state %q, want running, stopped, deleted or ssh-ready", target)
+	}
+
+	return waitForServer(cmd, args[0], target)
+}
+
+// waitIfRequested waits for target when the command was run with --wait.
+func waitIfRequested(cmd *cobra.Command, serverId, target string) error {
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil || !wait {
+		return err
+	}
+	return waitForServer(cmd, serverId, target)
+}
+
+func waitForServer(cmd *cobra.Command, serverId, target string) error {
+	timeout, err := cmd.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+
+	opts := api.DefaultWaitOptions
+	opts.Timeout = timeout
+	opts.Progress = logProgress(serverId)
+
+	if target == statusSSHReady {
+		return api.Poll(cmd.Context(), target, opts, checkSSHReady(serverId))
+	}
+	return client.WaitForStatus(cmd.Context(), serverId, target, opts)
+}
+
+// logProgress logs every state change seen while waiting.
+func logProgress(serverId string) func(string, time.Duration) {
+	last := ""
+	return func(state string, elapsed time.Duration) {
+		if state != last {
+			log.Printf("%v: %v (%v)", serverId, state, elapsed.Round(time.Second))
+			last = state
+		}
+	}
+}
+
+// checkSSHReady reports done once the server is running and an SSH banner
+// comes back from its forwarded port 22.
+func checkSSHReady(serverId string) api.CheckFunc {
+	return func(ctx context.Context) (string, bool, error) {
+		res, err := client.GetServer(ctx, serverId)
+		if err != nil {
+			return "", false, err
+		}
+
+		vm := res.VirtualMachines
+		if vm.Status != "running" {
+			return vm.Status, false, nil
+		}
+
+		if err := probeSSH(ctx, sshAddress(vm)); err != nil {
+			return "running, ssh not answering", false, nil
+		}
+		return statusSSHReady, true, nil
+	}
+}
+
+// probeSSH connects to addr and checks that it greets with an SSH banner.
+func probeSSH(ctx context.Context, addr string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("unexpected banner %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/api"
+)
+
+func TestServersWait(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := runCommand(t, srv, "servers", "stop", testServerID, "--wait"); err != nil {
+		t.Fatalf("servers stop --wait: %v", err)
+	}
+
+	if _, err := runCommand(t, srv, "servers", "wait", testServerID, "--for", "stopped"); err != nil {
+		t.Fatalf("servers wait --for stopped: %v", err)
+	}
+
+	_, err := runCommand(t, srv, "servers", "wait", testServerID, "--for", "running", "--wait-timeout", "10ms")
+	if code := exitCode(err); code != exitTimeout {
+		t.Errorf("timed out wait: exitCode = %v (%v), want %v", code, err, exitTimeout)
+	}
+
+	if _, err := runCommand(t, srv, "servers", "wait", testServerID, "--for", "paused"); err == nil {
+		t.Error("unknown state: expected an error")
+	}
+
+	if _, err := runCommand(t, srv, "servers", "delete", testServerID, "--wait"); err != nil {
+		t.Fatalf("servers delete --wait: %v", err)
+	}
+}
+
+func TestServersWaitSSHReady(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	srv := newTestServer(t)
+	vm, _ := srv.VM(testServerID)
+	vm.IP = "127.0.0.1"
+	vm.PortForwards = map[string]string{port: "22"}
+	srv.AddServer(testServerID, vm)
+
+	if _, err := runCommand(t, srv, "servers", "wait", testServerID, "--for", "ssh-ready", "--wait-timeout", "5s"); err != nil {
+		t.Fatalf("servers wait --for ssh-ready: %v", err)
+	}
+}
+
+func TestSSHAddress(t *testing.T) {
+	vm := api.VirtualMachine{IP: "203.0.113.10", PortForwards: map[string]string{"20089": "47989", "20022": "22"}}
+	if got := sshAddress(vm); got != "203.0.113.10:20022" {
+		t.Errorf("sshAddress = %v", got)
+	}
+
+	vm.PortForwards = nil
+	if got := sshAddress(vm); !strings.HasSuffix(got, ":22") {
+		t.Errorf("sshAddress without forward = %v", got)
+	}
+}
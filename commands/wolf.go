@@ -2,8 +2,9 @@ package commands
 
 import (
 	"fmt"
-	"strings"
+	"path"
 
+	"github.com/raefon/td-stream/wolf"
 	"github.com/spf13/cobra"
 )
 
@@ -16,22 +17,7 @@ var (
 		Use:   "logs server_id",
 		Short: "Get wolf logs",
 		Args:  cobra.ExactArgs(1), // Expects exactly one argument: server_id
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// Hardcoded container ID
-			containerID := "wolf-wolf-1"
-			dockerCommand := "docker logs " + containerID
-
-			// Prepare the arguments for dockerCommandsViaSSH
-			dockerArgs := append([]string{args[0]}, dockerCommand)
-
-			// Ensure flags are set for SSH
-			cmd.Flags().String("bin", "ssh", "Name of SSH client executable (e.g., ssh, mosh)")
-			cmd.Flags().String("user", "user", "User account to use for login")
-			cmd.Flags().String("command", "", "Command to execute over SSH")
-
-			// Call dockerCommandsViaSSH with the server ID and the Docker command
-			return dockerCommandsViaSSH(cmd, dockerArgs)
-		},
+		RunE:  wolfLogs,
 	}
 	wolfInstallCmd = &cobra.Command{
 		Use:   "install server_id",
@@ -40,39 +26,24 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			serverID := args[0]
 
-			cmd.Flags().String("bin", "ssh", "Name of SSH client executable (e.g., ssh, mosh)")
-			cmd.Flags().String("user", "user", "User account to use for login")
-			cmd.Flags().String("command", "", "Command to execute over SSH")
-
 			return wolfInstall(cmd, serverID)
 		},
 	}
 )
 
 func init() {
+	addSSHFlags(wolfLogsCmd)
+	addWolfLogsFlags(wolfLogsCmd)
 	wolfCmd.AddCommand(wolfLogsCmd)
+
+	addSSHFlags(wolfInstallCmd)
 	wolfCmd.AddCommand(wolfInstallCmd)
 	rootCmd.AddCommand(wolfCmd)
 }
 
+// getWolfFiles uploads the wolf files bundled with this binary.
 func getWolfFiles(cmd *cobra.Command, server string) error {
-	// Define the files and their target location
-	files := []string{"docker-compose.nvidia.yml", "docker-nvidia-start.sh"}
-	targetDir := "/home/user/"
-
-	// Build the curl command to fetch files from GitHub and place them in the target directory
-	curlCommands := make([]string, len(files))
-	for i, file := range files {
-		url := fmt.Sprintf("https://raw.githubusercontent.com/raefon/td-stream/main/wolf/%s", file)
-		curlCommands[i] = fmt.Sprintf("curl -o %s%s %s", targetDir, file, url)
-	}
-	fullCurlCommand := strings.Join(curlCommands, " && ")
-
-	// Set the command to be executed over SSH
-	cmd.Flags().Set("command", fullCurlCommand)
-
-	// Execute the SSH command
-	return sshServer(cmd, []string{server})
+	return uploadFiles(cmd, server, wolf.InstallDir, wolf.Files)
 }
 
 func wolfInstall(cmd *cobra.Command, server string) error {
@@ -83,11 +54,7 @@ func wolfInstall(cmd *cobra.Command, server string) error {
 	}
 
 	// Define the command to run docker-nvidia-start.sh
-	startScriptCommand := "bash /home/user/docker-nvidia-start.sh /home/user/docker-compose.nvidia.yml"
-
-	// Set the command to be executed over SSH
-	cmd.Flags().Set("command", startScriptCommand)
+	startScriptCommand := fmt.Sprintf("bash %v %v", path.Join(wolf.InstallDir, "docker-nvidia-start.sh"), path.Join(wolf.InstallDir, "docker-compose.nvidia.yml"))
 
-	// Execute the SSH command to run the script
-	return sshServer(cmd, []string{server})
+	return runScript(cmd, server, startScriptCommand)
 }
@@ -0,0 +1,291 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/raefon/td-stream/wolf"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wolfAppsCmd = &cobra.Command{
+		Use:   "apps",
+		Short: "Manage the apps Moonlight can launch through Wolf",
+	}
+	wolfAppsListCmd = &cobra.Command{
+		Use:   "list server_id",
+		Short: "List the apps of a server",
+		Args:  cobra.ExactArgs(1),
+		RunE:  wolfAppsList,
+	}
+	wolfAppsAddCmd = &cobra.Command{
+		Use:   "add server_id [template]",
+		Short: "Add an app from a template or a file",
+		Long: fmt.Sprintf(`Add an app from a built-in template or, with --from-file, from a TOML file
+holding either one app (title and [runner]) or [[apps]] tables.
+
+Templates: %v`, strings.Join(wolf.TemplateNames(), ", ")),
+		Args: cobra.RangeArgs(1, 2),
+		RunE: wolfAppsAdd,
+	}
+	wolfAppsRemoveCmd = &cobra.Command{
+		Use:   "remove server_id title...",
+		Short: "Remove apps",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  wolfAppsRemove,
+	}
+	wolfAppsUpdateCmd = &cobra.Command{
+		Use:   "update server_id title",
+		Short: "Change an app",
+		Args:  cobra.ExactArgs(2),
+		RunE:  wolfAppsUpdate,
+	}
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{wolfAppsListCmd, wolfAppsAddCmd, wolfAppsRemoveCmd, wolfAppsUpdateCmd} {
+		addRemoteFlags(cmd)
+		wolfAppsCmd.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{wolfAppsAddCmd, wolfAppsRemoveCmd, wolfAppsUpdateCmd} {
+		cmd.Flags().Bool("no-restart", false, "Do not restart Wolf after the change")
+		cmd.Flags().Bool("dry-run", false, "Only show the change")
+	}
+	for _, cmd := range []*cobra.Command{wolfAppsAddCmd, wolfAppsUpdateCmd} {
+		flags := cmd.Flags()
+		flags.String("from-file", "", "Read the app definition from this TOML file")
+		flags.String("title", "", "Title shown in Moonlight")
+		flags.String("image", "", "Docker image of the app")
+		flags.String("name", "", "Name of the app's container")
+		flags.StringArray("env", nil, "Set an environment variable, NAME=value")
+		flags.StringArray("mount", nil, "Add a mount, source:destination[:mode]")
+		flags.StringArray("device", nil, "Add a device")
+		flags.StringArray("port", nil, "Add a port mapping")
+	}
+	wolfAppsAddCmd.Flags().String("gpu", "nvidia", fmt.Sprintf("GPU vendor the template is set up for (%v)", strings.Join(wolf.GPUs, ", ")))
+	wolfCmd.AddCommand(wolfAppsCmd)
+}
+
+func asApp(item interface{}) wolf.App {
+	return item.(wolf.App)
+}
+
+var wolfAppColumns = []column{
+	{Name: "Title", Value: func(i interface{}) interface{} { return asApp(i).Title }},
+	{Name: "Runner", Value: func(i interface{}) interface{} { return asApp(i).Runner.Type }},
+	{Name: "Image", Value: func(i interface{}) interface{} {
+		if r := asApp(i).Runner; r.Type == "process" {
+			return r.RunCmd
+		}
+		return asApp(i).Runner.Image
+	}},
+	{Name: "Container", Wide: true, Value: func(i interface{}) interface{} { return asApp(i).Runner.Name }},
+	{Name: "Compositor", Wide: true, Value: func(i interface{}) interface{} { return asApp(i).StartVirtualCompositor }},
+	{Name: "Env", Wide: true, Value: func(i interface{}) interface{} { return strings.Join(asApp(i).Runner.Env, " ") }},
+}
+
+// applyAppFlags applies the --title, --image, --env and similar flags to app.
+func applyAppFlags(cmd *cobra.Command, app *wolf.App) error {
+	flags := cmd.Flags()
+
+	for flag, field := range map[string]*string{
+		"title": &app.Title,
+		"image": &app.Runner.Image,
+		"name":  &app.Runner.Name,
+	} {
+		value, err := flags.GetString(flag)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*field = value
+		}
+	}
+
+	env, err := flags.GetStringArray("env")
+	if err != nil {
+		return err
+	}
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --env %q, want NAME=value", kv)
+		}
+		wolf.SetEnv(&app.Runner.Env, name, value)
+	}
+
+	for flag, list := range map[string]*[]string{
+		"mount":  &app.Runner.Mounts,
+		"device": &app.Runner.Devices,
+		"port":   &app.Runner.Ports,
+	} {
+		values, err := flags.GetStringArray(flag)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if !slices.Contains(*list, v) {
+				*list = append(*list, v)
+			}
+		}
+	}
+	return nil
+}
+
+// appsFromFlags reads the apps named by --from-file or a template argument.
+func appsFromFlags(cmd *cobra.Command, args []string) ([]wolf.App, error) {
+	fromFile, err := cmd.Flags().GetString("from-file")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case fromFile != "" && len(args) > 0:
+		return nil, fmt.Errorf("give either a template or --from-file")
+	case fromFile != "":
+		data, err := os.ReadFile(fromFile)
+		if err != nil {
+			return nil, err
+		}
+		apps, err := wolf.ParseApps(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", fromFile, err)
+		}
+		return apps, nil
+	case len(args) == 0:
+		return nil, fmt.Errorf("give a template (%v) or --from-file", strings.Join(wolf.TemplateNames(), ", "))
+	}
+
+	gpu, err := cmd.Flags().GetString("gpu")
+	if err != nil {
+		return nil, err
+	}
+	app, err := wolf.Template(args[0], gpu)
+	if err != nil {
+		return nil, err
+	}
+	return []wolf.App{app}, nil
+}
+
+func wolfAppsList(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, _, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return err
+	}
+
+	v := view{Columns: wolfAppColumns}
+	for _, app := range cfg.Apps {
+		v.Items = append(v.Items, app)
+	}
+	return render(cmd, v)
+}
+
+func wolfAppsAdd(cmd *cobra.Command, args []string) error {
+	apps, err := appsFromFlags(cmd, args[1:])
+	if err != nil {
+		return err
+	}
+
+	if len(apps) == 1 {
+		if err := applyAppFlags(cmd, &apps[0]); err != nil {
+			return err
+		}
+	} else {
+		for _, flag := range []string{"title", "image", "name", "env", "mount", "device", "port"} {
+			if cmd.Flags().Changed(flag) {
+				return fmt.Errorf("--%v only applies to a single app, the file defines %v", flag, len(apps))
+			}
+		}
+	}
+
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, before, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		if err := doc.AddApp(app); err != nil {
+			return err
+		}
+	}
+
+	return saveWolfConfig(cmd, c, before, doc)
+}
+
+func wolfAppsRemove(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, before, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	for _, title := range args[1:] {
+		removed, err := doc.RemoveApp(title)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("no app titled %q", title)
+		}
+	}
+
+	return saveWolfConfig(cmd, c, before, doc)
+}
+
+func wolfAppsUpdate(cmd *cobra.Command, args []string) error {
+	var replacement *wolf.App
+	fromFile, err := cmd.Flags().GetString("from-file")
+	if err != nil {
+		return err
+	}
+	if fromFile != "" {
+		apps, err := appsFromFlags(cmd, nil)
+		if err != nil {
+			return err
+		}
+		if len(apps) != 1 {
+			return fmt.Errorf("%v defines %v apps, update takes one", fromFile, len(apps))
+		}
+		replacement = &apps[0]
+	}
+
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, before, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	err = doc.UpdateApp(args[1], func(app *wolf.App) error {
+		if replacement != nil {
+			*app = *replacement
+		}
+		return applyAppFlags(cmd, app)
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveWolfConfig(cmd, c, before, doc)
+}
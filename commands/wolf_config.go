@@ -0,0 +1,328 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/wolf"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wolfConfigCmd = &cobra.Command{
+		Use:   "config",
+		Short: "View and change the Wolf config.toml of a server",
+		Long: `View and change /etc/wolf/cfg/config.toml on a server.
+
+Keys are dotted paths into the TOML document, with array elements addressed
+by index, e.g. hostname or apps.0.runner.image. Every change is validated,
+the previous file is kept next to it as config.toml.<time>.bak and Wolf is
+restarted to pick the change up.`,
+	}
+	wolfConfigGetCmd = &cobra.Command{
+		Use:   "get server_id [key]",
+		Short: "Print the config, or the value of one key",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  wolfConfigGet,
+	}
+	wolfConfigSetCmd = &cobra.Command{
+		Use:   "set server_id key=value...",
+		Short: "Change config values",
+		Long: `Change config values. Values are parsed as TOML, so true, 42 and ["a", "b"]
+keep their types; anything else is stored as a string.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: wolfConfigSet,
+	}
+	wolfConfigEditCmd = &cobra.Command{
+		Use:   "edit server_id",
+		Short: "Edit the config in $VISUAL or $EDITOR",
+		Args:  cobra.ExactArgs(1),
+		RunE:  wolfConfigEdit,
+	}
+	wolfConfigDiffCmd = &cobra.Command{
+		Use:   "diff server_id [file]",
+		Short: "Compare the config with a local file, or with its last backup",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  wolfConfigDiff,
+	}
+)
+
+// wolfContainer is the container docker compose starts Wolf in.
+const wolfContainer = "wolf-wolf-1"
+
+func init() {
+	for _, cmd := range []*cobra.Command{wolfConfigGetCmd, wolfConfigSetCmd, wolfConfigEditCmd, wolfConfigDiffCmd} {
+		addRemoteFlags(cmd)
+		wolfConfigCmd.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{wolfConfigSetCmd, wolfConfigEditCmd} {
+		cmd.Flags().Bool("no-restart", false, "Do not restart Wolf after the change")
+		cmd.Flags().Bool("dry-run", false, "Only show the change")
+	}
+	wolfCmd.AddCommand(wolfConfigCmd)
+}
+
+// readWolfConfig fetches config.toml from the server.
+func readWolfConfig(ctx context.Context, c *remote.Client) ([]byte, error) {
+	res, err := c.Output(ctx, "sudo cat -- "+remote.Quote(wolf.ConfigPath))
+	if err != nil {
+		return nil, fmt.Errorf("reading %v: %w: %s", wolf.ConfigPath, err, bytes.TrimSpace(res.Stderr))
+	}
+	return res.Stdout, nil
+}
+
+// loadWolfConfig fetches and parses config.toml. It also returns the
+// contents, to diff changes against.
+func loadWolfConfig(cmd *cobra.Command, c *remote.Client) (*wolf.Document, []byte, error) {
+	data, err := readWolfConfig(cmd.Context(), c)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := wolf.ParseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, data, nil
+}
+
+// saveWolfConfig validates doc, shows how it differs from before, backs up
+// the config on the server, replaces it and restarts Wolf. It honours the
+// --dry-run and --no-restart flags of cmd.
+func saveWolfConfig(cmd *cobra.Command, c *remote.Client, before []byte, doc *wolf.Document) error {
+	flags := cmd.Flags()
+
+	if err := doc.Validate(); err != nil {
+		return err
+	}
+	after, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+
+	diff := unifiedDiff(wolf.ConfigPath, wolf.ConfigPath, string(before), string(after))
+	if diff == "" {
+		log.Print("wolf config unchanged")
+		return nil
+	}
+
+	dryRun, err := flags.GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprint(cmd.OutOrStdout(), diff)
+		return nil
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), diff)
+
+	if err := writeWolfConfig(cmd.Context(), c, after); err != nil {
+		return err
+	}
+
+	noRestart, err := flags.GetBool("no-restart")
+	if err != nil {
+		return err
+	}
+	if noRestart {
+		log.Print("wolf config saved, restart Wolf to apply it")
+		return nil
+	}
+	return restartWolf(cmd, c)
+}
+
+// writeWolfConfig backs up config.toml and replaces it with data.
+func writeWolfConfig(ctx context.Context, c *remote.Client, data []byte) error {
+	backup := fmt.Sprintf("%v.%v.bak", wolf.ConfigPath, time.Now().UTC().Format("20060102T150405Z"))
+	path := remote.Quote(wolf.ConfigPath)
+	script := fmt.Sprintf("set -e; cp -p %[1]v %[2]v; cat > %[1]v.new; chmod --reference=%[1]v %[1]v.new; mv %[1]v.new %[1]v", path, remote.Quote(backup))
+
+	var stderr bytes.Buffer
+	if err := c.Run(ctx, "sudo sh -c "+remote.Quote(script), bytes.NewReader(data), nil, &stderr); err != nil {
+		return fmt.Errorf("writing %v: %w: %s", wolf.ConfigPath, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	log.Printf("wolf config saved, the previous version is %v", backup)
+	return nil
+}
+
+func restartWolf(cmd *cobra.Command, c *remote.Client) error {
+	log.Print("restarting wolf")
+	return c.Run(cmd.Context(), "docker restart "+wolfContainer, nil, nil, cmd.ErrOrStderr())
+}
+
+func wolfConfigGet(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, data, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	key := args[1]
+	value, err := doc.Get(key)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out, err := toml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	case []interface{}:
+		out, err := toml.Marshal(map[string]interface{}{key[strings.LastIndex(key, ".")+1:]: v})
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	default:
+		fmt.Fprintln(cmd.OutOrStdout(), v)
+		return nil
+	}
+}
+
+func wolfConfigSet(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	doc, before, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid assignment %q, want key=value", arg)
+		}
+		if err := doc.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return saveWolfConfig(cmd, c, before, doc)
+}
+
+func wolfConfigEdit(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	_, before, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "td-stream-wolf-")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, before, 0o600); err != nil {
+		return err
+	}
+
+	if err := runEditor(path); err != nil {
+		return fmt.Errorf("editor: %w, your copy is kept in %v", err, path)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := wolf.ParseDocument(edited)
+	if err == nil {
+		err = saveWolfConfig(cmd, c, before, doc)
+	}
+	if err != nil {
+		return fmt.Errorf("%w\nyour copy is kept in %v", err, path)
+	}
+	return os.RemoveAll(dir)
+}
+
+// runEditor opens path in $VISUAL, $EDITOR or vi.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may come with arguments, e.g. "code --wait".
+	editCmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	return editCmd.Run()
+}
+
+func wolfConfigDiff(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	_, current, err := loadWolfConfig(cmd, c)
+	if err != nil {
+		return err
+	}
+
+	var otherName string
+	var other []byte
+	if len(args) == 2 {
+		otherName = args[1]
+		if other, err = os.ReadFile(otherName); err != nil {
+			return err
+		}
+	} else {
+		res, err := c.Output(cmd.Context(), "sudo sh -c "+remote.Quote(fmt.Sprintf("ls -1 -- %v.*.bak | tail -n 1", remote.Quote(wolf.ConfigPath))))
+		if err != nil {
+			return err
+		}
+		otherName = strings.TrimSpace(string(res.Stdout))
+		if otherName == "" {
+			return fmt.Errorf("%v has no backup yet", wolf.ConfigPath)
+		}
+		res, err = c.Output(cmd.Context(), "sudo cat -- "+remote.Quote(otherName))
+		if err != nil {
+			return fmt.Errorf("reading %v: %w", otherName, err)
+		}
+		other = res.Stdout
+	}
+
+	if _, err := wolf.ParseDocument(other); err != nil {
+		return fmt.Errorf("%v: %w", otherName, err)
+	}
+
+	// A backup is the old version of the config, a local file the new one.
+	if len(args) == 2 {
+		fmt.Fprint(cmd.OutOrStdout(), unifiedDiff(wolf.ConfigPath, otherName, string(current), string(other)))
+	} else {
+		fmt.Fprint(cmd.OutOrStdout(), unifiedDiff(otherName, wolf.ConfigPath, string(other), string(current)))
+	}
+	return nil
+}
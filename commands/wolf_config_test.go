@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+)
+
+const testWolfConfig = `config_version = 4
+hostname = "Wolf"
+
+[[apps]]
+title = "Firefox"
+start_virtual_compositor = true
+
+[apps.runner]
+type = "docker"
+name = "WolfFirefox"
+image = "ghcr.io/games-on-whales/firefox:edge"
+
+[gstreamer.video]
+default_source = "waylanddisplaysrc"
+`
+
+// wolfHost emulates the parts of a server the wolf config commands use.
+type wolfHost struct {
+	mu        sync.Mutex
+	config    string
+	backups   int
+	restarts  int
+	lastWrite string
+}
+
+func (h *wolfHost) handle(e remotetest.Exec) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case e.Command == "sudo cat -- '/etc/wolf/cfg/config.toml'":
+		io.WriteString(e.Stdout, h.config)
+	case strings.HasPrefix(e.Command, "sudo sh -c ") && strings.Contains(e.Command, "cat > "):
+		data, _ := io.ReadAll(e.Stdin)
+		h.config, h.lastWrite = string(data), e.Command
+		h.backups++
+	case e.Command == "docker restart wolf-wolf-1":
+		h.restarts++
+	default:
+		return 127
+	}
+	return 0
+}
+
+func TestWolfConfigSet(t *testing.T) {
+	srv := newTestServer(t)
+	host := &wolfHost{config: testWolfConfig}
+	sshSrv := newSSHServer(t, srv, host.handle)
+
+	out, err := runCommand(t, srv, "wolf", "config", "get", testServerID, "apps.0.runner.image", "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("wolf config get: %v", err)
+	}
+	if out != "ghcr.io/games-on-whales/firefox:edge\n" {
+		t.Errorf("wolf config get = %q", out)
+	}
+
+	out, err = runCommand(t, srv, "wolf", "config", "set", testServerID, "hostname=Gaming", "--dry-run", "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("wolf config set --dry-run: %v", err)
+	}
+	if !strings.Contains(out, `-hostname = "Wolf"`) || !strings.Contains(out, "+hostname = 'Gaming'") {
+		t.Errorf("dry run diff:\n%v", out)
+	}
+	if host.backups != 0 {
+		t.Fatal("dry run wrote the config")
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "config", "set", testServerID, "hostname=Gaming", "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf config set: %v", err)
+	}
+	if host.backups != 1 || host.restarts != 1 {
+		t.Errorf("backups = %v, restarts = %v, want 1 and 1", host.backups, host.restarts)
+	}
+	if !strings.Contains(host.lastWrite, "config.toml.") || !strings.Contains(host.lastWrite, ".bak") {
+		t.Errorf("write did not back up the config: %v", host.lastWrite)
+	}
+	if !strings.Contains(host.config, "hostname = 'Gaming'") || !strings.Contains(host.config, "waylanddisplaysrc") {
+		t.Errorf("config after set:\n%v", host.config)
+	}
+
+	_, err = runCommand(t, srv, "wolf", "config", "set", testServerID, "apps.0.runner.type=vm", "--keyPath", sshSrv.KeyPath)
+	if err == nil || !strings.Contains(err.Error(), `unknown runner type "vm"`) {
+		t.Errorf("invalid change err = %v", err)
+	}
+	if host.backups != 1 {
+		t.Error("an invalid config was written")
+	}
+}
+
+func TestWolfConfigEdit(t *testing.T) {
+	srv := newTestServer(t)
+	host := &wolfHost{config: testWolfConfig}
+	sshSrv := newSSHServer(t, srv, host.handle)
+
+	editor := filepath.Join(t.TempDir(), "editor")
+	script := "#!/bin/sh\nsed -i 's/\"Wolf\"/\"Edited\"/' \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", editor)
+
+	if _, err := runCommand(t, srv, "wolf", "config", "edit", testServerID, "--no-restart", "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf config edit: %v", err)
+	}
+	if !strings.Contains(host.config, `hostname = "Edited"`) {
+		t.Errorf("config after edit:\n%v", host.config)
+	}
+	if host.restarts != 0 {
+		t.Error("--no-restart restarted Wolf")
+	}
+}
+
+func TestWolfApps(t *testing.T) {
+	srv := newTestServer(t)
+	host := &wolfHost{config: testWolfConfig}
+	sshSrv := newSSHServer(t, srv, host.handle)
+	key := "--keyPath=" + sshSrv.KeyPath
+
+	if _, err := runCommand(t, srv, "wolf", "apps", "add", testServerID, "steam", "--env", "PROTON_LOG=0", "--mount", "/games:/games", key); err != nil {
+		t.Fatalf("wolf apps add: %v", err)
+	}
+
+	out, err := runCommand(t, srv, "wolf", "apps", "list", testServerID, "-o", "wide", key)
+	if err != nil {
+		t.Fatalf("wolf apps list: %v", err)
+	}
+	for _, want := range []string{"Firefox", "Steam", "ghcr.io/games-on-whales/steam:edge", "PROTON_LOG=0", "/dev/nvidia*"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("apps list missing %q:\n%v", want, out)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "kodi.toml")
+	kodi := "title = \"Kodi\"\n[runner]\ntype = \"docker\"\nname = \"WolfKodi\"\nimage = \"kodi:latest\"\n"
+	if err := os.WriteFile(file, []byte(kodi), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCommand(t, srv, "wolf", "apps", "add", testServerID, "--from-file", file, key); err != nil {
+		t.Fatalf("wolf apps add --from-file: %v", err)
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "apps", "update", testServerID, "kodi", "--image", "kodi:21", key); err != nil {
+		t.Fatalf("wolf apps update: %v", err)
+	}
+	if _, err := runCommand(t, srv, "wolf", "apps", "remove", testServerID, "Firefox", key); err != nil {
+		t.Fatalf("wolf apps remove: %v", err)
+	}
+
+	if strings.Contains(host.config, "Firefox") || !strings.Contains(host.config, "kodi:21") || !strings.Contains(host.config, "/games:/games") {
+		t.Errorf("config after changes:\n%v", host.config)
+	}
+	if host.restarts != 4 {
+		t.Errorf("restarts = %v, want one per change", host.restarts)
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "apps", "remove", testServerID, "Doom", key); err == nil {
+		t.Error("removing a missing app succeeded")
+	}
+}
@@ -0,0 +1,264 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// wolfLogLevels are Wolf's log levels from least to most severe.
+var wolfLogLevels = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// logLevel finds the level of a Wolf log line, which follows the time:
+// "10:21:04.123456 INFO  | Starting HTTP server on port 47989".
+var logLevel = regexp.MustCompile(`^(?:\S+\s+)?(TRACE|DEBUG|INFO|WARN(?:ING)?|ERROR|FATAL)\b`)
+
+// Docker's formats for container names, --since and --tail. Values are
+// checked against them so they can go into the command unquoted.
+var (
+	containerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	logsSince     = regexp.MustCompile(`^[0-9A-Za-z:.+-]+$`)
+	logsTail      = regexp.MustCompile(`^([0-9]+|all)$`)
+)
+
+func addWolfLogsFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.BoolP("follow", "f", false, "Keep streaming new log lines")
+	flags.String("since", "", "Only logs since a time or duration, e.g. 2024-05-01T10:00:00 or 30m")
+	flags.String("tail", "", "Only the last N lines")
+	flags.String("grep", "", "Only lines matching this regular expression")
+	flags.String("level", "", fmt.Sprintf("Only lines at this level or above (%v)", strings.ToLower(strings.Join(wolfLogLevels, ", "))))
+	flags.String("container", wolfContainer, "Container to read the logs of")
+	flags.Bool("save", false, "Save the logs to a timestamped file in the current directory instead of printing them")
+}
+
+// levelIndex returns the position of level in wolfLogLevels, or -1.
+func levelIndex(level string) int {
+	level = strings.ToUpper(level)
+	if level == "WARNING" {
+		level = "WARN"
+	}
+	for i, l := range wolfLogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// logFilter writes the lines that pass its level and pattern to w. Lines
+// without a level, like the rest of a stack trace, share the fate of the
+// line before them. It is safe for concurrent use.
+type logFilter struct {
+	w        io.Writer
+	grep     *regexp.Regexp
+	minLevel int
+
+	mu   sync.Mutex
+	keep bool
+	buf  []byte
+}
+
+func newLogFilter(w io.Writer, grep *regexp.Regexp, minLevel int) *logFilter {
+	return &logFilter{w: w, grep: grep, minLevel: minLevel, keep: true}
+}
+
+func (f *logFilter) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buf = append(f.buf, b...)
+	for {
+		i := bytes.IndexByte(f.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := f.line(f.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		f.buf = f.buf[i+1:]
+	}
+}
+
+// Flush writes a last line that has no newline.
+func (f *logFilter) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.buf) == 0 {
+		return nil
+	}
+	line := append(f.buf, '\n')
+	f.buf = nil
+	return f.line(line)
+}
+
+func (f *logFilter) line(line []byte) error {
+	if m := logLevel.FindSubmatch(line); m != nil {
+		f.keep = levelIndex(string(m[1])) >= f.minLevel
+	}
+	if !f.keep || (f.grep != nil && !f.grep.Match(line)) {
+		return nil
+	}
+	_, err := f.w.Write(line)
+	return err
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(b)
+}
+
+// wolfLogsCommand builds the docker logs command line from the flags.
+func wolfLogsCommand(cmd *cobra.Command) (string, error) {
+	flags := cmd.Flags()
+
+	container, err := flags.GetString("container")
+	if err != nil {
+		return "", err
+	}
+	follow, err := flags.GetBool("follow")
+	if err != nil {
+		return "", err
+	}
+	since, err := flags.GetString("since")
+	if err != nil {
+		return "", err
+	}
+	tail, err := flags.GetString("tail")
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case !containerName.MatchString(container):
+		return "", fmt.Errorf("invalid container name %q", container)
+	case since != "" && !logsSince.MatchString(since):
+		return "", fmt.Errorf("invalid --since %q, want a timestamp or a duration like 30m", since)
+	case tail != "" && !logsTail.MatchString(tail):
+		return "", fmt.Errorf("invalid --tail %q, want a number of lines or all", tail)
+	}
+
+	args := []string{"docker", "logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	if tail != "" {
+		args = append(args, "--tail", tail)
+	}
+	return strings.Join(append(args, container), " "), nil
+}
+
+func wolfLogs(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	server := args[0]
+
+	command, err := wolfLogsCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	pattern, err := flags.GetString("grep")
+	if err != nil {
+		return err
+	}
+	level, err := flags.GetString("level")
+	if err != nil {
+		return err
+	}
+	save, err := flags.GetBool("save")
+	if err != nil {
+		return err
+	}
+	if save {
+		// The server ID names the saved file.
+		if err := checkFileName(server); err != nil {
+			return err
+		}
+	}
+
+	bin, err := flags.GetString("bin")
+	if err != nil {
+		return err
+	}
+	if bin != "" {
+		if pattern != "" || level != "" || save {
+			return fmt.Errorf("--grep, --level and --save need the built-in SSH client, drop --bin")
+		}
+		return dockerCommandsViaSSH(cmd, []string{server, command})
+	}
+
+	var grep *regexp.Regexp
+	if pattern != "" {
+		if grep, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+	minLevel := 0
+	if level != "" {
+		if minLevel = levelIndex(level); minLevel < 0 {
+			return fmt.Errorf("unknown level %q, want one of %v", level, strings.ToLower(strings.Join(wolfLogLevels, ", ")))
+		}
+	}
+
+	c, err := sshClient(cmd, server)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	var file *os.File
+	if save {
+		name := fmt.Sprintf("wolf-%v-%v.log", server, time.Now().UTC().Format("20060102T150405Z"))
+		if file, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	// Each stream gets its own filter so their partial lines are not
+	// joined; the filters share the output a line at a time.
+	shared := &lockedWriter{w: out}
+	stdout, stderr := newLogFilter(shared, grep, minLevel), newLogFilter(shared, grep, minLevel)
+	err = c.Run(cmd.Context(), command, nil, stdout, stderr)
+	for _, filter := range []*logFilter{stdout, stderr} {
+		if flushErr := filter.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	// Interrupting --follow is how it ends.
+	if errors.Is(cmd.Context().Err(), context.Canceled) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), file.Name())
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+)
+
+const testWolfLog = `10:21:04.100000 DEBUG | Loading config
+10:21:04.200000 INFO  | Starting HTTP server on port 47989
+10:21:05.300000 WARN  | No GPU found for app Steam
+10:21:06.400000 ERROR | Runner failed
+  at docker.cpp:120
+10:21:07.500000 INFO  | Insert pin at http://0.0.0.0:47989/pin/#ABCD`
+
+func TestLogFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		grep  string
+		level string
+		want  []string
+	}{
+		{name: "all", want: []string{"Loading config", "Starting HTTP", "No GPU", "Runner failed", "docker.cpp", "Insert pin"}},
+		{name: "level", level: "warning", want: []string{"No GPU", "Runner failed", "docker.cpp"}},
+		{name: "grep", grep: "pin|GPU", want: []string{"No GPU", "Insert pin"}},
+		{name: "both", grep: "[Pp]in", level: "info", want: []string{"Insert pin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var grep *regexp.Regexp
+			if tt.grep != "" {
+				grep = regexp.MustCompile(tt.grep)
+			}
+			minLevel := 0
+			if tt.level != "" {
+				minLevel = levelIndex(tt.level)
+			}
+
+			var out bytes.Buffer
+			f := newLogFilter(&out, grep, minLevel)
+			// Split writes across lines like a stream would.
+			for _, chunk := range []string{testWolfLog[:30], testWolfLog[30:170], testWolfLog[170:]} {
+				if _, err := io.WriteString(f, chunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %v lines, want %v:\n%v", len(lines), len(tt.want), out.String())
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("line %v = %q, want %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWolfLogs(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		if strings.HasPrefix(e.Command, "docker logs ") {
+			io.WriteString(e.Stdout, testWolfLog)
+			return 0
+		}
+		return 127
+	})
+
+	out, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath,
+		"--follow", "--since", "30m", "--tail", "100", "--container", "wolf-2", "--level", "error")
+	if err != nil {
+		t.Fatalf("wolf logs: %v", err)
+	}
+	if cmds := sshSrv.Commands(); cmds[len(cmds)-1] != "docker logs --follow --since 30m --tail 100 wolf-2" {
+		t.Errorf("command = %q", cmds[len(cmds)-1])
+	}
+	if want := "10:21:06.400000 ERROR | Runner failed\n  at docker.cpp:120\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath, "--since", "1h; rm -rf /"); err == nil {
+		t.Error("an unsafe --since was accepted")
+	}
+	if _, err := runCommand(t, srv, "wolf", "logs", testServerID, "--bin", "ssh", "--grep", "pin"); err == nil {
+		t.Error("--grep was accepted with --bin")
+	}
+	if _, err := runCommand(t, srv, "wolf", "logs", "../escape", "--save"); err == nil || !strings.Contains(err.Error(), "invalid name") {
+		t.Errorf("--save with a path as server: err = %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	out, err = runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath, "--save", "--grep", "pin")
+	if err != nil {
+		t.Fatalf("wolf logs --save: %v", err)
+	}
+	name := strings.TrimSpace(out)
+	if ok, _ := filepath.Match("wolf-"+testServerID+"-*.log", name); !ok {
+		t.Fatalf("saved to %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "/pin/#ABCD\n") || strings.Count(string(data), "\n") != 1 {
+		t.Errorf("saved log = %q", data)
+	}
+}
+
+func TestWolfLogsStreams(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		// Docker writes the container's stdout and stderr to separate
+		// streams, each may end a write halfway through a line. The pauses
+		// let the client copy every write before the next one.
+		for i, chunk := range []string{"10:21:04.100000 INFO  | Starting ", "10:21:05.200000 ERROR | Runner ", "HTTP server\n", "failed\n"} {
+			w := e.Stdout
+			if i%2 == 1 {
+				w = e.Stderr
+			}
+			io.WriteString(w, chunk)
+			time.Sleep(20 * time.Millisecond)
+		}
+		return 0
+	})
+
+	out, err := runCommand(t, srv, "wolf", "logs", testServerID, "--keyPath", sshSrv.KeyPath, "--grep", ".")
+	if err != nil {
+		t.Fatalf("wolf logs: %v", err)
+	}
+	for _, want := range []string{"10:21:04.100000 INFO  | Starting HTTP server\n", "10:21:05.200000 ERROR | Runner failed\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output = %q, want the line %q", out, want)
+		}
+	}
+}
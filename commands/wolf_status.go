@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/setup"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wolfStatusCmd = &cobra.Command{
+		Use:   "status server_id",
+		Short: "Check that Wolf and what it needs on the server are healthy",
+		Args:  cobra.ExactArgs(1),
+		RunE:  wolfStatus,
+	}
+)
+
+func init() {
+	addRemoteFlags(wolfStatusCmd)
+	wolfCmd.AddCommand(wolfStatusCmd)
+}
+
+// wolfDevices are the device nodes Wolf and its apps need.
+var wolfDevices = []string{"/dev/uinput", "/dev/nvidia0", "/dev/nvidiactl", "/dev/nvidia-modeset", "/dev/nvidia-uvm"}
+
+// udevRulesDir is where setup.sh installs the udev rules.
+const udevRulesDir = "/etc/udev/rules.d"
+
+// healthCheck is one check of `wolf status`. Run returns a detail to show
+// and an error when the check fails.
+type healthCheck struct {
+	Name string
+	Run  func(ctx context.Context, c *remote.Client) (string, error)
+}
+
+// checkResult is the outcome of a healthCheck.
+type checkResult struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+func asCheckResult(item interface{}) checkResult {
+	return item.(checkResult)
+}
+
+var checkColumns = []column{
+	{Name: "Check", Value: func(i interface{}) interface{} { return asCheckResult(i).Check }},
+	{Name: "Result", Value: func(i interface{}) interface{} {
+		if asCheckResult(i).Passed {
+			return "PASS"
+		}
+		return "FAIL"
+	}},
+	{Name: "Detail", Value: func(i interface{}) interface{} { return asCheckResult(i).Detail }},
+}
+
+var wolfHealthChecks = []healthCheck{
+	{Name: "container", Run: checkWolfContainer},
+	{Name: "nvidia driver volume", Run: checkDriverVolume},
+	{Name: "devices", Run: checkDevices},
+	{Name: "udev rules", Run: checkUdevRules},
+	{Name: "http", Run: checkWolfHTTP},
+	{Name: "https", Run: checkWolfHTTPS},
+}
+
+// output runs command and returns its trimmed stdout, or an error that
+// includes its stderr.
+func output(ctx context.Context, c *remote.Client, command string) (string, error) {
+	res, err := c.Output(ctx, command)
+	if err != nil {
+		if msg := bytes.TrimSpace(res.Stderr); len(msg) > 0 {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+func checkWolfContainer(ctx context.Context, c *remote.Client) (string, error) {
+	out, err := output(ctx, c, "docker inspect -f '{{.State.Status}} {{.RestartCount}}' "+wolfContainer)
+	if err != nil {
+		return "", err
+	}
+	status, restarts, _ := strings.Cut(out, " ")
+	detail := fmt.Sprintf("%v, %v restarts", status, restarts)
+	if status != "running" {
+		return "", fmt.Errorf("%v", detail)
+	}
+	return detail, nil
+}
+
+var driverLibrary = regexp.MustCompile(`libnvidia-ml\.so\.(\d+\.\d+(?:\.\d+)?)`)
+
+func checkDriverVolume(ctx context.Context, c *remote.Client) (string, error) {
+	want, err := output(ctx, c, "cat /sys/module/nvidia/version")
+	if err != nil {
+		return "", fmt.Errorf("no nvidia kernel module loaded: %w", err)
+	}
+
+	libs, err := output(ctx, c, `sudo sh -c 'find "$(docker volume inspect -f "{{.Mountpoint}}" nvidia-driver-vol)" -name "libnvidia-ml.so.*"'`)
+	if err != nil {
+		return "", err
+	}
+	m := driverLibrary.FindStringSubmatch(libs)
+	if m == nil {
+		return "", fmt.Errorf("nvidia-driver-vol holds no driver")
+	}
+	if m[1] != want {
+		return "", fmt.Errorf("volume has driver %v, the kernel module is %v", m[1], want)
+	}
+	return "driver " + want, nil
+}
+
+func checkDevices(ctx context.Context, c *remote.Client) (string, error) {
+	quoted := make([]string, len(wolfDevices))
+	for i, d := range wolfDevices {
+		quoted[i] = remote.Quote(d)
+	}
+	out, err := output(ctx, c, fmt.Sprintf("for d in %v; do test -e \"$d\" || echo \"$d\"; done", strings.Join(quoted, " ")))
+	if err != nil {
+		return "", err
+	}
+	if out != "" {
+		return "", fmt.Errorf("missing %v", strings.Join(strings.Fields(out), ", "))
+	}
+	return strings.Join(wolfDevices, ", "), nil
+}
+
+func checkUdevRules(ctx context.Context, c *remote.Client) (string, error) {
+	files, err := bundledFiles(setup.Files)
+	if err != nil {
+		return "", err
+	}
+	var rules []remote.File
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, ".rules") {
+			rules = append(rules, f)
+		}
+	}
+
+	sums, err := remoteChecksums(ctx, c, udevRulesDir, rules)
+	if err != nil {
+		return "", err
+	}
+	var problems, names []string
+	for _, f := range rules {
+		names = append(names, f.Name)
+		switch sum, ok := sums[path.Join(udevRulesDir, f.Name)]; {
+		case !ok:
+			problems = append(problems, f.Name+" missing")
+		case sum != checksum(f.Data):
+			problems = append(problems, f.Name+" differs")
+		}
+	}
+	if len(problems) > 0 {
+		return "", fmt.Errorf("%v, run `td-stream setup`", strings.Join(problems, ", "))
+	}
+	return strings.Join(names, ", "), nil
+}
+
+// dialer opens connections from the server itself, so Wolf's ports are
+// checked even when they are not forwarded.
+func dialer(c *remote.Client) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := c.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return conn.Dial(network, addr)
+	}
+}
+
+func checkWolfHTTP(ctx context.Context, c *remote.Client) (string, error) {
+	httpClient := &http.Client{
+		Transport: &http.Transport{DialContext: dialer(c)},
+		Timeout:   10 * time.Second,
+	}
+	addr := fmt.Sprintf("127.0.0.1:%v", wolfHTTPPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/serverinfo", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("/serverinfo answered %v", res.Status)
+	}
+	return addr + " serverinfo OK", nil
+}
+
+func checkWolfHTTPS(ctx context.Context, c *remote.Client) (string, error) {
+	addr := fmt.Sprintf("127.0.0.1:%v", wolfHTTPSPort)
+	conn, err := dialer(c)(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// Wolf's certificate is self-signed; a completed handshake shows it is
+	// serving.
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", fmt.Errorf("TLS handshake: %w", err)
+	}
+	return addr + " TLS OK", nil
+}
+
+// runHealthChecks runs every check and returns the results and how many
+// failed.
+func runHealthChecks(ctx context.Context, c *remote.Client) ([]checkResult, int) {
+	results := make([]checkResult, 0, len(wolfHealthChecks))
+	failed := 0
+	for _, check := range wolfHealthChecks {
+		detail, err := check.Run(ctx, c)
+		if err != nil {
+			detail = err.Error()
+			failed++
+		}
+		results = append(results, checkResult{Check: check.Name, Passed: err == nil, Detail: detail})
+	}
+	return results, failed
+}
+
+// renderHealthChecks renders results and fails when a check failed.
+func renderHealthChecks(cmd *cobra.Command, results []checkResult, failed int) error {
+	v := view{Columns: checkColumns}
+	for _, r := range results {
+		v.Items = append(v.Items, r)
+	}
+	if err := render(cmd, v); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func wolfStatus(cmd *cobra.Command, args []string) error {
+	c, err := sshClient(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	results, failed := runHealthChecks(cmd.Context(), c)
+	return renderHealthChecks(cmd, results, failed)
+}
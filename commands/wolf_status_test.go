@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/raefon/td-stream/setup"
+)
+
+func TestWolfStatus(t *testing.T) {
+	srv := newTestServer(t)
+	sshSrv := newSSHServer(t, srv, func(e remotetest.Exec) int {
+		switch {
+		case e.Command == "docker inspect -f '{{.State.Status}} {{.RestartCount}}' wolf-wolf-1":
+			io.WriteString(e.Stdout, "running 2\n")
+		case e.Command == "cat /sys/module/nvidia/version":
+			io.WriteString(e.Stdout, "535.183.01\n")
+		case strings.Contains(e.Command, "nvidia-driver-vol"):
+			io.WriteString(e.Stdout, "/var/lib/docker/volumes/nvidia-driver-vol/_data/lib/libnvidia-ml.so.535.183.01\n")
+		case strings.HasPrefix(e.Command, "for d in "):
+			io.WriteString(e.Stdout, "/dev/uinput\n")
+		default:
+			return 127
+		}
+		return 0
+	})
+
+	rules, err := fs.Glob(setup.Files, "*.rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range rules {
+		data, _ := fs.ReadFile(setup.Files, name)
+		sshSrv.SetFile(path.Join(udevRulesDir, name), data)
+	}
+
+	serverinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/serverinfo" {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(serverinfo.Close)
+	https := httptest.NewUnstartedServer(http.NotFoundHandler())
+	// The check hangs up right after the handshake.
+	https.Config.ErrorLog = log.New(io.Discard, "", 0)
+	https.StartTLS()
+	t.Cleanup(https.Close)
+	sshSrv.Redirect("127.0.0.1:47989", serverinfo.Listener.Addr().String())
+	sshSrv.Redirect("127.0.0.1:47984", https.Listener.Addr().String())
+
+	out, err := runCommand(t, srv, "wolf", "status", testServerID, "--keyPath", sshSrv.KeyPath)
+	if err == nil || err.Error() != "1 of 6 checks failed" {
+		t.Errorf("err = %v, want 1 of 6 checks failed", err)
+	}
+
+	for _, want := range []string{
+		"running, 2 restarts",
+		"driver 535.183.01",
+		"missing /dev/uinput",
+		"serverinfo OK",
+		"TLS OK",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("status missing %q:\n%v", want, out)
+		}
+	}
+	if got := strings.Count(out, "PASS"); got != 5 {
+		t.Errorf("%v checks passed, want 5:\n%v", got, out)
+	}
+}
@@ -0,0 +1,272 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/raefon/td-stream/api"
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/state"
+	"github.com/raefon/td-stream/wolf"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wolfUpgradeCmd = &cobra.Command{
+		Use:   "upgrade server_id",
+		Short: "Upgrade Wolf to the latest image of a tag",
+		Long: `Upgrade Wolf to the latest image of a tag.
+
+upgrade records the running image, pulls the tag, recreates the Wolf container
+pinned to the new digest and waits for the health checks of ` + "`wolf status`" + ` to
+pass. The images are kept with the outcome of their checks so ` + "`wolf rollback`" + `
+can go back to one that worked.`,
+		Args: cobra.ExactArgs(1),
+		RunE: wolfUpgrade,
+	}
+	wolfRollbackCmd = &cobra.Command{
+		Use:   "rollback server_id",
+		Short: "Go back to the Wolf image that ran before the last upgrade",
+		Args:  cobra.ExactArgs(1),
+		RunE:  wolfRollback,
+	}
+)
+
+func init() {
+	wolfUpgradeCmd.Flags().String("tag", wolf.DefaultTag, "Tag of "+wolf.Image+" to upgrade to")
+	for _, cmd := range []*cobra.Command{wolfUpgradeCmd, wolfRollbackCmd} {
+		cmd.Flags().Duration("check-timeout", 2*time.Minute, "How long to wait for the health checks to pass")
+		addRemoteFlags(cmd)
+		wolfCmd.AddCommand(cmd)
+	}
+}
+
+// imageTag is the format of a Docker tag.
+var imageTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// Health of a deployed Wolf image. The image found running before the
+// first upgrade has no status.
+const (
+	releaseChecking = "checking"
+	releaseHealthy  = "healthy"
+	releaseFailed   = "failed"
+)
+
+// wolfRelease is a Wolf image deployed on a server.
+type wolfRelease struct {
+	Image      string    `json:"image"`
+	Tag        string    `json:"tag,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// failed reports whether the health checks of the release never passed.
+func (r wolfRelease) failed() bool {
+	return r.Status == releaseChecking || r.Status == releaseFailed
+}
+
+// wolfHistoryStateName is the state file of the images deployed on a
+// server, the running one last.
+func wolfHistoryStateName(serverId string) string {
+	return "wolf-images/" + serverId + ".json"
+}
+
+// localWolfImage is the repository images without a registry digest are
+// tagged in, so that they can be pinned and rolled back to.
+const localWolfImage = "td-stream/wolf"
+
+// pinnedImage returns a reference that pins the image of ref: its registry
+// digest, e.g. "ghcr.io/games-on-whales/wolf@sha256:...". A bare image ID
+// cannot go into the compose file, so images without a digest, like local
+// builds, are tagged td-stream/wolf:rollback-<short ID> instead.
+func pinnedImage(ctx context.Context, c *remote.Client, ref string) (string, error) {
+	out, err := output(ctx, c, "docker image inspect -f '{{.Id}} {{join .RepoDigests \" \"}}' "+ref)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no image %v", ref)
+	}
+	for _, digest := range fields[1:] {
+		if strings.HasPrefix(digest, wolf.Image+"@") {
+			return digest, nil
+		}
+	}
+
+	id := strings.TrimPrefix(fields[0], "sha256:")
+	if len(id) < 12 || !imageTag.MatchString(id) {
+		return "", fmt.Errorf("image %v has no registry digest and an unexpected ID %q", ref, fields[0])
+	}
+	tagged := localWolfImage + ":rollback-" + id[:12]
+	if _, err := output(ctx, c, "docker tag "+remote.Quote(fields[0])+" "+tagged); err != nil {
+		return "", fmt.Errorf("tagging %v: %w", ref, err)
+	}
+	return tagged, nil
+}
+
+// runningWolfImage returns the pinned reference of the image Wolf runs.
+func runningWolfImage(ctx context.Context, c *remote.Client) (string, error) {
+	id, err := output(ctx, c, "docker inspect -f '{{.Image}}' "+wolfContainer)
+	if err != nil {
+		return "", fmt.Errorf("reading the running wolf image: %w", err)
+	}
+	return pinnedImage(ctx, c, remote.Quote(id))
+}
+
+// deployWolf recreates the Wolf container with image. The image is written
+// to the .env file next to the compose file so it stays pinned when Wolf
+// is started again by `wolf install`.
+func deployWolf(ctx context.Context, c *remote.Client, image string) error {
+	files, err := bundledFiles(wolf.Files)
+	if err != nil {
+		return err
+	}
+	files = append(files, remote.File{Name: ".env", Mode: 0o644, Data: []byte("WOLF_IMAGE=" + image + "\n")})
+	if err := syncFiles(ctx, c, wolf.InstallDir, files); err != nil {
+		return err
+	}
+
+	log.Printf("recreating wolf with %v", image)
+	compose := path.Join(wolf.InstallDir, "docker-compose.nvidia.yml")
+	_, err = output(ctx, c, "docker compose -p wolf -f "+remote.Quote(compose)+" up -d wolf")
+	return err
+}
+
+// waitHealthy runs the health checks until they pass or timeout expires
+// and renders the last results.
+func waitHealthy(cmd *cobra.Command, c *remote.Client, timeout time.Duration) error {
+	var results []checkResult
+	var failed int
+	opts := api.WaitOptions{Timeout: timeout, Interval: 2 * time.Second, MaxInterval: 10 * time.Second}
+	err := api.Poll(cmd.Context(), "wolf to be healthy", opts, func(ctx context.Context) (string, bool, error) {
+		results, failed = runHealthChecks(ctx, c)
+		return fmt.Sprintf("%v of %v checks failed", failed, len(results)), failed == 0, nil
+	})
+	if renderErr := renderHealthChecks(cmd, results, failed); err == nil {
+		err = renderErr
+	}
+	return err
+}
+
+func wolfUpgrade(cmd *cobra.Command, args []string) error {
+	serverId := args[0]
+
+	tag, err := cmd.Flags().GetString("tag")
+	if err != nil {
+		return err
+	}
+	if !imageTag.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	timeout, err := cmd.Flags().GetDuration("check-timeout")
+	if err != nil {
+		return err
+	}
+
+	c, err := sshClient(cmd, serverId)
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	var history []wolfRelease
+	if err := state.Load(wolfHistoryStateName(serverId), &history); err != nil {
+		return err
+	}
+	current, err := runningWolfImage(ctx, c)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 || history[len(history)-1].Image != current {
+		history = append(history, wolfRelease{Image: current, DeployedAt: time.Now().UTC()})
+		if err := state.Save(wolfHistoryStateName(serverId), history); err != nil {
+			return err
+		}
+	}
+
+	ref := wolf.Image + ":" + tag
+	log.Printf("pulling %v", ref)
+	if _, err := output(ctx, c, "docker pull "+ref); err != nil {
+		return fmt.Errorf("pulling %v: %w", ref, err)
+	}
+	image, err := pinnedImage(ctx, c, ref)
+	if err != nil {
+		return err
+	}
+	if image == current {
+		fmt.Fprintf(cmd.OutOrStdout(), "wolf on %v already runs the latest %v\n", serverId, ref)
+		return nil
+	}
+
+	if err := deployWolf(ctx, c, image); err != nil {
+		return err
+	}
+	// The image is recorded as running before it is checked, so that
+	// rollback knows what to go back from even if the checks never end.
+	history = append(history, wolfRelease{Image: image, Tag: tag, Status: releaseChecking, DeployedAt: time.Now().UTC()})
+	if err := state.Save(wolfHistoryStateName(serverId), history); err != nil {
+		return err
+	}
+
+	healthErr := waitHealthy(cmd, c, timeout)
+	history[len(history)-1].Status = releaseHealthy
+	if healthErr != nil {
+		history[len(history)-1].Status = releaseFailed
+	}
+	if err := state.Save(wolfHistoryStateName(serverId), history); err != nil {
+		return err
+	}
+	if healthErr != nil {
+		return fmt.Errorf("%w, go back with `td-stream wolf rollback %v`", healthErr, serverId)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "wolf on %v upgraded to %v\n", serverId, image)
+	return nil
+}
+
+func wolfRollback(cmd *cobra.Command, args []string) error {
+	serverId := args[0]
+
+	timeout, err := cmd.Flags().GetDuration("check-timeout")
+	if err != nil {
+		return err
+	}
+
+	var history []wolfRelease
+	if err := state.Load(wolfHistoryStateName(serverId), &history); err != nil {
+		return err
+	}
+	// Images whose health checks never passed are skipped.
+	i := len(history) - 2
+	for i >= 0 && history[i].failed() {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("no earlier wolf image recorded for %v", serverId)
+	}
+	previous := history[i]
+
+	c, err := sshClient(cmd, serverId)
+	if err != nil {
+		return err
+	}
+
+	if err := deployWolf(cmd.Context(), c, previous.Image); err != nil {
+		return err
+	}
+	history = history[:i+1]
+	if err := state.Save(wolfHistoryStateName(serverId), history); err != nil {
+		return err
+	}
+
+	if err := waitHealthy(cmd, c, timeout); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "wolf on %v rolled back to %v\n", serverId, previous.Image)
+	return nil
+}
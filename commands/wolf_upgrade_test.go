@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/raefon/td-stream/remote"
+	"github.com/raefon/td-stream/remote/remotetest"
+	"github.com/raefon/td-stream/state"
+)
+
+const (
+	// The running image is a local build without a registry digest.
+	oldWolfImage = "td-stream/wolf:rollback-111111111111"
+	newWolfImage = "ghcr.io/games-on-whales/wolf@sha256:bbbb"
+)
+
+func TestWolfUpgradeRollback(t *testing.T) {
+	checks := wolfHealthChecks
+	t.Cleanup(func() { wolfHealthChecks = checks })
+	var healthy atomic.Bool
+	healthy.Store(true)
+	wolfHealthChecks = []healthCheck{{Name: "container", Run: func(context.Context, *remote.Client) (string, error) {
+		if !healthy.Load() {
+			return "", errors.New("restarting")
+		}
+		return "running", nil
+	}}}
+
+	// The fake docker knows two images: the running one and the one the
+	// stable tag points to.
+	ids := map[string]string{oldWolfImage: "sha256:1111111111112222", newWolfImage: "sha256:2222"}
+	var mu sync.Mutex
+	running := oldWolfImage
+	var pulls int
+	var tagged bool
+	var sshSrv *remotetest.Server
+	runningImage := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return running
+	}
+
+	srv := newTestServer(t)
+	sshSrv = newSSHServer(t, srv, func(e remotetest.Exec) int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case e.Command == "docker inspect -f '{{.Image}}' wolf-wolf-1":
+			fmt.Fprintln(e.Stdout, ids[running])
+		case strings.HasPrefix(e.Command, "docker image inspect "):
+			ref := strings.Trim(e.Command[strings.LastIndex(e.Command, " ")+1:], "'")
+			for image, id := range ids {
+				if ref == id || (ref == "ghcr.io/games-on-whales/wolf:stable" && image == newWolfImage) {
+					if image == oldWolfImage {
+						image = ""
+					}
+					fmt.Fprintf(e.Stdout, "%v %v\n", id, image)
+					return 0
+				}
+			}
+			io.WriteString(e.Stderr, "No such image\n")
+			return 1
+		case strings.HasPrefix(e.Command, "mkdir -p -- "):
+		case e.Command == "docker tag 'sha256:1111111111112222' "+oldWolfImage:
+			tagged = true
+		case e.Command == "docker pull ghcr.io/games-on-whales/wolf:stable":
+			pulls++
+		case e.Command == "docker compose -p wolf -f '/home/user/docker-compose.nvidia.yml' up -d wolf":
+			env, _ := sshSrv.File("/home/user/.env")
+			running = strings.TrimSpace(strings.TrimPrefix(string(env), "WOLF_IMAGE="))
+		default:
+			return 127
+		}
+		return 0
+	})
+
+	out, err := runCommand(t, srv, "wolf", "upgrade", testServerID, "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("wolf upgrade: %v", err)
+	}
+	if got := runningImage(); got != newWolfImage {
+		t.Errorf("running %v after upgrade, want %v", got, newWolfImage)
+	}
+	if !strings.Contains(out, "PASS") || !strings.Contains(out, "upgraded to "+newWolfImage) {
+		t.Errorf("upgrade output:\n%v", out)
+	}
+
+	var history []wolfRelease
+	if err := state.Load(wolfHistoryStateName(testServerID), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Image != oldWolfImage || history[1].Image != newWolfImage || history[1].Tag != "stable" || history[1].Status != releaseHealthy {
+		t.Errorf("history after upgrade = %+v", history)
+	}
+
+	// Upgrading again finds nothing newer.
+	out, err = runCommand(t, srv, "wolf", "upgrade", testServerID, "--keyPath", sshSrv.KeyPath)
+	if err != nil {
+		t.Fatalf("second wolf upgrade: %v", err)
+	}
+	if !strings.Contains(out, "already runs the latest") {
+		t.Errorf("second upgrade output = %q", out)
+	}
+	mu.Lock()
+	if pulls != 2 {
+		t.Errorf("%v pulls, want 2", pulls)
+	}
+	if !tagged {
+		t.Error("the local build was not tagged to pin it")
+	}
+	mu.Unlock()
+
+	if _, err := runCommand(t, srv, "wolf", "rollback", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf rollback: %v", err)
+	}
+	if got := runningImage(); got != oldWolfImage {
+		t.Errorf("running %v after rollback, want %v", got, oldWolfImage)
+	}
+	history = nil
+	if err := state.Load(wolfHistoryStateName(testServerID), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Image != oldWolfImage {
+		t.Errorf("history after rollback = %+v", history)
+	}
+
+	// A failed upgrade is kept, but never rolled back to.
+	healthy.Store(false)
+	_, err = runCommand(t, srv, "wolf", "upgrade", testServerID, "--keyPath", sshSrv.KeyPath, "--check-timeout", "10ms")
+	if err == nil || !strings.Contains(err.Error(), "wolf rollback") {
+		t.Fatalf("unhealthy upgrade: err = %v", err)
+	}
+	healthy.Store(true)
+	history = nil
+	if err := state.Load(wolfHistoryStateName(testServerID), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Status != releaseFailed {
+		t.Fatalf("history after a failed upgrade = %+v", history)
+	}
+	// An older failed image must be skipped by the rollbacks below too.
+	history = append([]wolfRelease{{Image: newWolfImage, Status: releaseFailed}}, history...)
+	if err := state.Save(wolfHistoryStateName(testServerID), history); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCommand(t, srv, "wolf", "rollback", testServerID, "--keyPath", sshSrv.KeyPath); err != nil {
+		t.Fatalf("wolf rollback after a failed upgrade: %v", err)
+	}
+	if got := runningImage(); got != oldWolfImage {
+		t.Errorf("running %v after rollback, want %v", got, oldWolfImage)
+	}
+
+	_, err = runCommand(t, srv, "wolf", "rollback", testServerID, "--keyPath", sshSrv.KeyPath)
+	if err == nil || !strings.Contains(err.Error(), "no earlier wolf image") {
+		t.Errorf("rollback without history: err = %v", err)
+	}
+
+	if _, err := runCommand(t, srv, "wolf", "upgrade", testServerID, "--keyPath", sshSrv.KeyPath, "--tag", "latest; reboot"); err == nil {
+		t.Error("an invalid tag was accepted")
+	}
+}
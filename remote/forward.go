@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// ForwardLocal listens on local and carries every connection through the
+// server to remote, like ssh -L. It returns the address it listens on and
+// forwards until ctx is done.
+func (c *Client) ForwardLocal(ctx context.Context, local, remote string) (net.Addr, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	go serve(ctx, ln, func() (net.Conn, error) { return conn.Dial("tcp", remote) })
+	return ln.Addr(), nil
+}
+
+// ForwardRemote has the server listen on remote and carries every
+// connection back to local, like ssh -R. It returns the address the server
+// listens on and forwards until ctx is done.
+func (c *Client) ForwardRemote(ctx context.Context, remote, local string) (net.Addr, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := conn.Listen("tcp", remote)
+	if err != nil {
+		return nil, err
+	}
+
+	go serve(ctx, ln, func() (net.Conn, error) { return net.Dial("tcp", local) })
+	return ln.Addr(), nil
+}
+
+// serve accepts connections on ln until ctx is done and pipes each one to
+// a connection from dial.
+func serve(ctx context.Context, ln net.Listener, dial func() (net.Conn, error)) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		in, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			out, err := dial()
+			if err != nil {
+				in.Close()
+				return
+			}
+			pipe(in, out)
+		}()
+	}
+}
+
+// pipe copies between a and b until either side is done, then closes both.
+func pipe(a, b net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		a.Close()
+		b.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(a, b)
+		once.Do(closeBoth)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(b, a)
+		once.Do(closeBoth)
+	}()
+	wg.Wait()
+}
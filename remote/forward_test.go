@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+)
+
+// echoServer answers every line it receives with the same line.
+func echoServer(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func roundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v", line, err)
+	}
+}
+
+func TestForwardLocal(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := c.ForwardLocal(ctx, "127.0.0.1:0", echoServer(t))
+	if err != nil {
+		t.Fatalf("ForwardLocal: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, conn)
+}
+
+func TestForwardRemote(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := c.ForwardRemote(ctx, "127.0.0.1:0", echoServer(t))
+	if err != nil {
+		t.Fatalf("ForwardRemote: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, conn)
+}
+
+func TestSOCKS(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := c.SOCKS(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("SOCKS: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, port, _ := net.SplitHostPort(echoServer(t))
+	portNum, _ := strconv.Atoi(port)
+
+	// Greeting without authentication, then CONNECT to the domain name.
+	req := []byte{5, 1, 0, 5, 1, 0, 3, byte(len("localhost"))}
+	req = append(req, "localhost"...)
+	req = binary.BigEndian.AppendUint16(req, uint16(portNum))
+	// Clients may send data without waiting for the reply.
+	req = append(req, "early\n"...)
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 12)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != 5 || reply[1] != 0 || reply[3] != 0 {
+		t.Fatalf("SOCKS reply = %v", reply)
+	}
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "early\n" {
+		t.Fatalf("echo of the data sent with the request = %q, %v", line, err)
+	}
+	roundTrip(t, conn)
+}
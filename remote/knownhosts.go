@@ -0,0 +1,247 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyChangedError is returned when a server presents a different host
+// key than the one pinned for it.
+type HostKeyChangedError struct {
+	ID   string
+	Want ssh.PublicKey
+	Got  ssh.PublicKey
+	Path string
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf(`
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@    WARNING: HOST KEY OF SERVER %v HAS CHANGED!    @
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+Someone could be eavesdropping on you right now, or the server was reinstalled.
+Pinned key:    %v
+Presented key: %v
+Pinned in %v. If the change is expected, forget the old key with
+`+"`td-stream known-hosts forget %v`"+` and connect again.`,
+		e.ID, ssh.FingerprintSHA256(e.Want), ssh.FingerprintSHA256(e.Got), e.Path, e.ID)
+}
+
+// KnownHosts pins host keys by server ID in an OpenSSH known_hosts file,
+// using the ID where OpenSSH expects a host name. The file can therefore be
+// used with ssh's HostKeyAlias and UserKnownHostsFile options. Changes hold
+// an flock on Path.lock, so concurrent connections, even from other
+// processes, never lose each other's pins.
+type KnownHosts struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewKnownHosts returns the store kept at path.
+func NewKnownHosts(path string) *KnownHosts {
+	return &KnownHosts{Path: path}
+}
+
+// HostKey is a pinned key.
+type HostKey struct {
+	ID  string
+	Key ssh.PublicKey
+}
+
+// Keys returns every pinned key in file order.
+func (k *KnownHosts) Keys() ([]HostKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.read()
+}
+
+// Lookup returns the key pinned for id, if any.
+func (k *KnownHosts) Lookup(id string) (ssh.PublicKey, error) {
+	keys, err := k.Keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return key.Key, nil
+		}
+	}
+	return nil, nil
+}
+
+// Callback verifies host keys for server id. The first key seen is pinned
+// (trust on first use); a key matching none of the keys pinned for id, of
+// which OpenSSH may add one per key type, fails with a
+// *HostKeyChangedError.
+func (k *KnownHosts) Callback(id string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		unlock, err := k.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		keys, err := k.read()
+		if err != nil {
+			return err
+		}
+
+		var want ssh.PublicKey
+		for _, pinned := range keys {
+			if pinned.ID != id {
+				continue
+			}
+			if bytes.Equal(pinned.Key.Marshal(), key.Marshal()) {
+				return nil
+			}
+			if want == nil {
+				want = pinned.Key
+			}
+		}
+		if want != nil {
+			return &HostKeyChangedError{ID: id, Want: want, Got: key, Path: k.Path}
+		}
+
+		return k.write(append(keys, HostKey{ID: id, Key: key}))
+	}
+}
+
+// Algorithms returns the host key algorithms to negotiate with server id so
+// that it presents one of the pinned keys, or nil when no key is pinned.
+func (k *KnownHosts) Algorithms(id string) []string {
+	keys, err := k.Keys()
+	if err != nil {
+		return nil
+	}
+
+	var algos []string
+	for _, key := range keys {
+		if key.ID != id || slices.Contains(algos, key.Key.Type()) {
+			continue
+		}
+		// RSA keys are pinned by type but signed with SHA-2.
+		if key.Key.Type() == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		} else {
+			algos = append(algos, key.Key.Type())
+		}
+	}
+	return algos
+}
+
+// Forget removes the key pinned for id and reports whether there was one.
+func (k *KnownHosts) Forget(id string) (bool, error) {
+	unlock, err := k.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	keys, err := k.read()
+	if err != nil {
+		return false, err
+	}
+
+	kept := keys[:0]
+	for _, key := range keys {
+		if key.ID != id {
+			kept = append(kept, key)
+		}
+	}
+	if len(kept) == len(keys) {
+		return false, nil
+	}
+	return true, k.write(kept)
+}
+
+// lock takes the store for a read-modify-write of the file.
+func (k *KnownHosts) lock() (func(), error) {
+	k.mu.Lock()
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0o700); err != nil {
+		k.mu.Unlock()
+		return nil, err
+	}
+	f, err := os.OpenFile(k.Path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		k.mu.Unlock()
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		k.mu.Unlock()
+		return nil, fmt.Errorf("locking %v: %w", f.Name(), err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+		k.mu.Unlock()
+	}, nil
+}
+
+func (k *KnownHosts) read() ([]HostKey, error) {
+	data, err := os.ReadFile(k.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []HostKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		_, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", k.Path, line, err)
+		}
+		for _, host := range hosts {
+			keys = append(keys, HostKey{ID: host, Key: key})
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func (k *KnownHosts) write(keys []HostKey) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Managed by td-stream, updated %v\n", time.Now().UTC().Format(time.RFC3339))
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%v %s", key.ID, ssh.MarshalAuthorizedKey(key.Key))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.Path), filepath.Base(k.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.Path)
+}
@@ -0,0 +1,171 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHosts(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	kh := NewKnownHosts(filepath.Join(t.TempDir(), "td-stream", "known_hosts"))
+
+	connect := func() error {
+		c := NewClient(srv.Addr, Config{
+			User:              remotetest.User,
+			KeyPath:           srv.KeyPath,
+			HostKeyCallback:   kh.Callback("server-1"),
+			HostKeyAlgorithms: kh.Algorithms("server-1"),
+		})
+		defer c.Close()
+		_, err := c.Output(context.Background(), "echo hi")
+		return err
+	}
+
+	if err := connect(); err != nil {
+		t.Fatalf("first connect: %v", err)
+	}
+	pinned, err := kh.Lookup("server-1")
+	if err != nil || pinned == nil {
+		t.Fatalf("Lookup = %v, %v", pinned, err)
+	}
+	data, _ := os.ReadFile(kh.Path)
+	if !strings.Contains(string(data), "server-1 ssh-ed25519 ") {
+		t.Errorf("known_hosts is not in OpenSSH format:\n%s", data)
+	}
+
+	if err := connect(); err != nil {
+		t.Fatalf("second connect: %v", err)
+	}
+
+	srv.RotateHostKey(t)
+	err = connect()
+	var changed *HostKeyChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("err = %v, want *HostKeyChangedError", err)
+	}
+	if changed.ID != "server-1" || !strings.Contains(err.Error(), "HAS CHANGED") {
+		t.Errorf("err = %v", err)
+	}
+
+	if forgotten, err := kh.Forget("server-1"); err != nil || !forgotten {
+		t.Fatalf("Forget = %v, %v", forgotten, err)
+	}
+	if forgotten, _ := kh.Forget("server-1"); forgotten {
+		t.Error("Forget twice reported a key")
+	}
+	if err := connect(); err != nil {
+		t.Fatalf("connect after forget: %v", err)
+	}
+}
+
+func TestKnownHostsConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "td-stream", "known_hosts")
+
+	// Separate stores on one file stand in for parallel connections and
+	// other td-stream processes.
+	const servers = 8
+	errs := make(chan error, servers)
+	for i := 0; i < servers; i++ {
+		srv := remotetest.NewServer(t, handle)
+		id := fmt.Sprintf("server-%v", i)
+		go func() {
+			kh := NewKnownHosts(path)
+			c := NewClient(srv.Addr, Config{User: remotetest.User, KeyPath: srv.KeyPath, HostKeyCallback: kh.Callback(id)})
+			defer c.Close()
+			_, err := c.Output(context.Background(), "echo hi")
+			errs <- err
+		}()
+	}
+	for i := 0; i < servers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+	}
+
+	keys, err := NewKnownHosts(path).Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != servers {
+		t.Errorf("%v keys pinned, want %v", len(keys), servers)
+	}
+
+	// Handshakes spread connections out; call the callbacks together too.
+	const hosts = 50
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < hosts; i++ {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback := NewKnownHosts(path).Callback(fmt.Sprintf("host-%v", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if err := callback("host", nil, key); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if keys, err = NewKnownHosts(path).Keys(); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != servers+hosts {
+		t.Errorf("%v keys pinned, want %v", len(keys), servers+hosts)
+	}
+}
+
+func TestKnownHostsSeveralKeys(t *testing.T) {
+	kh := NewKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	// OpenSSH adds a line per key type the server offers.
+	first, second := newKey(), newKey()
+	if err := kh.write([]HostKey{{"other", newKey()}, {"server-1", first}, {"server-1", second}}); err != nil {
+		t.Fatal(err)
+	}
+
+	callback := kh.Callback("server-1")
+	for i, key := range []ssh.PublicKey{first, second} {
+		if err := callback("host", nil, key); err != nil {
+			t.Errorf("pinned key %v: %v", i, err)
+		}
+	}
+
+	var changed *HostKeyChangedError
+	if err := callback("host", nil, newKey()); !errors.As(err, &changed) {
+		t.Errorf("unknown key: err = %v, want *HostKeyChangedError", err)
+	}
+	if algos := kh.Algorithms("server-1"); len(algos) != 1 || algos[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("Algorithms = %v, want [%v]", algos, ssh.KeyAlgoED25519)
+	}
+}
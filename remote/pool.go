@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"errors"
+	"sync"
+)
+
+// Pool shares one Client per user and address, so the many commands of an
+// install reuse a single connection.
+type Pool struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewPool returns an empty pool.
+func NewPool() *Pool {
+	return &Pool{clients: map[string]*Client{}}
+}
+
+// Client returns the pooled client for cfg.User at addr, creating it if
+// needed.
+func (p *Pool) Client(addr string, cfg Config) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := cfg.User + "@" + addr
+	if c, ok := p.clients[key]; ok {
+		return c
+	}
+	c := NewClient(addr, cfg)
+	p.clients[key] = c
+	return c
+}
+
+// Close closes every pooled connection.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for key, c := range p.clients {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(p.clients, key)
+	}
+	return errors.Join(errs...)
+}
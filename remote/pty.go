@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Shell runs command, or a login shell when command is empty, on a PTY
+// wired to the local terminal. The terminal is put in raw mode for the
+// duration of the session.
+func (c *Client) Shell(ctx context.Context, command string, stdin *os.File, stdout, stderr io.Writer) error {
+	session, err := c.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	fd := int(stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		termName := os.Getenv("TERM")
+		if termName == "" {
+			termName = "xterm-256color"
+		}
+		if err := session.RequestPty(termName, height, width, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+			return err
+		}
+
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		defer signal.Stop(resize)
+		go func() {
+			for range resize {
+				if width, height, err := term.GetSize(fd); err == nil {
+					session.WindowChange(height, width)
+				}
+			}
+		}()
+	}
+
+	session.Stdout, session.Stderr = outputs(stdout, stderr)
+	if err := attachStdin(session, stdin); err != nil {
+		return err
+	}
+
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return err
+	}
+	return wait(ctx, session, command)
+}
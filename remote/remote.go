@@ -0,0 +1,322 @@
+// Package remote runs commands on servers over SSH without relying on a
+// local OpenSSH client.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DefaultTimeout bounds dialing and the SSH handshake.
+const DefaultTimeout = 15 * time.Second
+
+// ErrDisconnected is returned when the connection drops before the remote
+// command reports an exit status, e.g. because the command rebooted the
+// server.
+var ErrDisconnected = errors.New("connection closed before the command exited")
+
+// ExitError is returned when a remote command exits with a non-zero status
+// or is killed by a signal.
+type ExitError struct {
+	Command string
+	Status  int
+	Signal  string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("remote command %q killed by signal %v", e.Command, e.Signal)
+	}
+	return fmt.Sprintf("remote command %q exited with status %v", e.Command, e.Status)
+}
+
+// Config describes how to log in to a server.
+type Config struct {
+	User string
+	// KeyPath is a private key file. When empty the SSH agent and the
+	// default keys in ~/.ssh are tried.
+	KeyPath string
+	// Timeout bounds dialing and the handshake, DefaultTimeout if 0.
+	Timeout time.Duration
+	// HostKeyCallback verifies the server's host key. It is required.
+	HostKeyCallback ssh.HostKeyCallback
+	// HostKeyAlgorithms, if set, restricts the host keys the server may
+	// present, e.g. to the type of a pinned key.
+	HostKeyAlgorithms []string
+}
+
+// Client is a connection to one server. It is opened lazily and reopened
+// when it dropped, so it survives reboots between commands.
+type Client struct {
+	addr string
+	cfg  Config
+
+	mu   sync.Mutex
+	conn *ssh.Client
+}
+
+// NewClient returns a client for addr, a host:port pair. No connection is
+// made until the first command.
+func NewClient(addr string, cfg Config) *Client {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Client{addr: addr, cfg: cfg}
+}
+
+// Addr returns the host:port the client connects to.
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Close closes the connection, if any.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Conn returns the underlying connection, dialing it if needed.
+func (c *Client) Conn(ctx context.Context) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	auth, err := authMethods(c.cfg.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+
+	conn, chans, reqs, err := ssh.NewClientConn(raw, c.addr, &ssh.ClientConfig{
+		User:              c.cfg.User,
+		Auth:              auth,
+		HostKeyCallback:   c.cfg.HostKeyCallback,
+		HostKeyAlgorithms: c.cfg.HostKeyAlgorithms,
+		Timeout:           c.cfg.Timeout,
+	})
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("ssh %v: %w", c.addr, err)
+	}
+	raw.SetDeadline(time.Time{})
+
+	c.conn = ssh.NewClient(conn, chans, reqs)
+	return c.conn, nil
+}
+
+// session opens a session, reconnecting once if the cached connection is
+// no longer usable.
+func (c *Client) session(ctx context.Context) (*ssh.Session, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := conn.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	c.Close()
+	if conn, err = c.Conn(ctx); err != nil {
+		return nil, err
+	}
+	return conn.NewSession()
+}
+
+// Run executes command with the given streams, which may be nil. It returns
+// an *ExitError when the command fails and ErrDisconnected when the
+// connection drops before it exits.
+func (c *Client) Run(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := c.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout, session.Stderr = outputs(stdout, stderr)
+	if err := attachStdin(session, stdin); err != nil {
+		return err
+	}
+
+	if err := session.Start(command); err != nil {
+		return err
+	}
+	return wait(ctx, session, command)
+}
+
+// Result is the captured output of a command.
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+	// ExitStatus is the status the command exited with.
+	ExitStatus int
+}
+
+// Output runs command and captures its output. A non-zero exit status is
+// reported in the result together with an *ExitError.
+func (c *Client) Output(ctx context.Context, command string) (Result, error) {
+	var stdout, stderr bytes.Buffer
+	err := c.Run(ctx, command, nil, &stdout, &stderr)
+
+	res := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitStatus = exitErr.Status
+	}
+	return res, err
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(b)
+}
+
+// outputs returns the writers for a session. The session copies stdout and
+// stderr from separate goroutines, so one writer given for both is locked.
+func outputs(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if stdout == nil || stderr == nil {
+		return stdout, stderr
+	}
+	if reflect.TypeOf(stdout).Comparable() && stdout == stderr {
+		w := &lockedWriter{w: stdout}
+		return w, w
+	}
+	return stdout, stderr
+}
+
+// attachStdin feeds stdin to the session without making Wait block on it,
+// which it would for a terminal that never reaches EOF.
+func attachStdin(session *ssh.Session, stdin io.Reader) error {
+	if stdin == nil {
+		return nil
+	}
+
+	pipe, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		io.Copy(pipe, stdin)
+		pipe.Close()
+	}()
+	return nil
+}
+
+// wait waits for the command to exit, killing it when ctx is done.
+func wait(ctx context.Context, session *ssh.Session, command string) error {
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return ctx.Err()
+	case err := <-done:
+		return exitError(command, err)
+	}
+}
+
+func exitError(command string, err error) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Command: command, Status: exitErr.ExitStatus(), Signal: exitErr.Signal()}
+	}
+
+	var missing *ssh.ExitMissingError
+	if errors.As(err, &missing) || errors.Is(err, io.EOF) {
+		return ErrDisconnected
+	}
+	return err
+}
+
+// authMethods offers the key at keyPath, or the agent and the default
+// keys when keyPath is empty.
+func authMethods(keyPath string) ([]ssh.AuthMethod, error) {
+	if keyPath != "" {
+		signer, err := loadKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		var signers []ssh.Signer
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if signer, err := loadKey(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH key found: set keyPath or start an SSH agent")
+	}
+	return methods, nil
+}
+
+func loadKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %v: %w", path, err)
+	}
+	return signer, nil
+}
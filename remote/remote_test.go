@@ -0,0 +1,171 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raefon/td-stream/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+)
+
+func handle(e remotetest.Exec) int {
+	switch e.Command {
+	case "echo hi":
+		fmt.Fprint(e.Stdout, "hi\n")
+	case "fail":
+		fmt.Fprint(e.Stderr, "boom\n")
+		return 3
+	case "sleep":
+		time.Sleep(5 * time.Second)
+	case "reboot":
+		return remotetest.Disconnect
+	case "chatty":
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(e.Stdout, "out %v\n", i)
+			fmt.Fprintf(e.Stderr, "err %v\n", i)
+		}
+	}
+	return 0
+}
+
+func testClient(srv *remotetest.Server, user string) *Client {
+	return NewClient(srv.Addr, Config{User: user, KeyPath: srv.KeyPath, HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+}
+
+func TestOutput(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+	ctx := context.Background()
+
+	res, err := c.Output(ctx, "echo hi")
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if string(res.Stdout) != "hi\n" || res.ExitStatus != 0 {
+		t.Errorf("Output = %+v", res)
+	}
+
+	res, err = c.Output(ctx, "fail")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Status != 3 {
+		t.Fatalf("err = %v, want exit status 3", err)
+	}
+	if res.ExitStatus != 3 || string(res.Stderr) != "boom\n" || len(res.Stdout) != 0 {
+		t.Errorf("Output = %+v", res)
+	}
+
+	if conns := srv.Conns(); conns != 1 {
+		t.Errorf("connections = %v, want 1", conns)
+	}
+}
+
+func TestRunSharedWriter(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+
+	// Both streams are copied concurrently; the race detector catches
+	// unserialized writes to the shared buffer.
+	var out bytes.Buffer
+	if err := c.Run(context.Background(), "chatty", nil, &out, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 200 {
+		t.Errorf("got %v lines, want 200", lines)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Run(ctx, "reboot", nil, nil, nil); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("reboot: err = %v, want ErrDisconnected", err)
+	}
+
+	if _, err := c.Output(ctx, "echo hi"); err != nil {
+		t.Fatalf("Output after reconnect: %v", err)
+	}
+	if conns := srv.Conns(); conns != 2 {
+		t.Errorf("connections = %v, want 2", conns)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.Run(ctx, "sleep", nil, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Run returned after %v", elapsed)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, "root")
+	defer c.Close()
+
+	_, err := c.Output(context.Background(), "echo hi")
+	if err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("err = %v, want an authentication error", err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	pool := NewPool()
+	defer pool.Close()
+
+	cfg := Config{User: remotetest.User, KeyPath: srv.KeyPath, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Client(srv.Addr, cfg).Output(context.Background(), "echo hi"); err != nil {
+			t.Fatalf("Output: %v", err)
+		}
+	}
+	if conns := srv.Conns(); conns != 1 {
+		t.Errorf("connections = %v, want 1", conns)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	srv := remotetest.NewServer(t, handle)
+	c := testClient(srv, remotetest.User)
+	defer c.Close()
+
+	err := c.Upload(context.Background(), "/home/user",
+		File{Name: "start.sh", Mode: 0o755, Data: []byte("#!/bin/sh\necho hi\n")},
+		File{Name: "empty.rules", Mode: 0o644},
+	)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if got, _ := srv.File("/home/user/start.sh"); string(got) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("start.sh = %q", got)
+	}
+	if _, ok := srv.File("/home/user/empty.rules"); !ok {
+		t.Error("empty.rules not uploaded")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := Quote("it's"); got != `'it'\''s'` {
+		t.Errorf("Quote = %v", got)
+	}
+}
@@ -0,0 +1,89 @@
+package remotetest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// File returns the contents of a file uploaded to the server.
+func (s *Server) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[name]
+	return data, ok
+}
+
+// SetFile stores a file on the server, as if it had been uploaded.
+func (s *Server) SetFile(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+}
+
+// builtin runs the commands the server emulates itself: an scp sink and
+// sha256sum over the stored files.
+func (s *Server) builtin(e Exec) (int, bool) {
+	switch {
+	case strings.HasPrefix(e.Command, "scp -qt -- "):
+		return s.scpSink(e, unquote(strings.TrimPrefix(e.Command, "scp -qt -- "))), true
+	case strings.HasPrefix(e.Command, "sha256sum -- "):
+		return s.sha256sum(e, strings.Fields(strings.TrimPrefix(e.Command, "sha256sum -- "))), true
+	}
+	return 0, false
+}
+
+func (s *Server) scpSink(e Exec, dir string) int {
+	r := bufio.NewReader(e.Stdin)
+	e.Stdout.Write([]byte{0})
+
+	for {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return 0
+		}
+
+		// C0644 <size> <name>
+		fields := strings.SplitN(strings.TrimSpace(header), " ", 3)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "C") {
+			fmt.Fprintf(e.Stdout, "\x02unsupported header %q\n", header)
+			return 1
+		}
+		size, err := strconv.Atoi(fields[1])
+		if err != nil {
+			fmt.Fprintf(e.Stdout, "\x02bad size %q\n", fields[1])
+			return 1
+		}
+		e.Stdout.Write([]byte{0})
+
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 1
+		}
+		s.SetFile(path.Join(dir, fields[2]), data[:size])
+		e.Stdout.Write([]byte{0})
+	}
+}
+
+func (s *Server) sha256sum(e Exec, names []string) int {
+	status := 0
+	for _, name := range names {
+		name = unquote(name)
+		data, ok := s.File(name)
+		if !ok {
+			fmt.Fprintf(e.Stderr, "sha256sum: %v: No such file or directory\n", name)
+			status = 1
+			continue
+		}
+		fmt.Fprintf(e.Stdout, "%x  %v\n", sha256.Sum256(data), name)
+	}
+	return status
+}
+
+func unquote(s string) string {
+	return strings.ReplaceAll(strings.Trim(s, "'"), `'\''`, "'")
+}
@@ -0,0 +1,130 @@
+package remotetest
+
+import (
+	"io"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Redirect makes connections the server opens for clients to from go to to
+// instead, so tests can stand in for services on fixed ports.
+func (s *Server) Redirect(from, to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redirect[from] = to
+}
+
+// directTCPIP serves a direct-tcpip channel, used by local forwards, by
+// dialing its target from the server.
+func (s *Server) directTCPIP(newChan ssh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &target); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	addr := net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+	s.mu.Lock()
+	if to, ok := s.redirect[addr]; ok {
+		addr = to
+	}
+	s.mu.Unlock()
+
+	out, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, requests, err := newChan.Accept()
+	if err != nil {
+		out.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	proxy(ch, out)
+}
+
+// globalRequests answers tcpip-forward requests, used by remote forwards,
+// by listening on the server and opening forwarded-tcpip channels back to
+// the client.
+func globalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		if req.Type != "tcpip-forward" {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+
+		var bind struct {
+			Addr string
+			Port uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &bind); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+
+		ln, err := net.Listen("tcp", net.JoinHostPort(bind.Addr, strconv.Itoa(int(bind.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(ln.Addr().(*net.TCPAddr).Port)
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+		go func() {
+			defer ln.Close()
+			go func() {
+				conn.Wait()
+				ln.Close()
+			}()
+
+			for {
+				in, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				origin := in.RemoteAddr().(*net.TCPAddr)
+				payload := ssh.Marshal(struct {
+					Addr     string
+					Port     uint32
+					OrigAddr string
+					OrigPort uint32
+				}{bind.Addr, port, origin.IP.String(), uint32(origin.Port)})
+
+				ch, requests, err := conn.OpenChannel("forwarded-tcpip", payload)
+				if err != nil {
+					in.Close()
+					continue
+				}
+				go ssh.DiscardRequests(requests)
+				go proxy(ch, in)
+			}
+		}()
+	}
+}
+
+func proxy(ch ssh.Channel, conn net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, ch)
+		done <- struct{}{}
+	}()
+	<-done
+	ch.Close()
+	conn.Close()
+}
@@ -0,0 +1,237 @@
+// Package remotetest provides an in-process SSH server for tests of code
+// that runs commands through the remote package.
+package remotetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// User is the only account the server accepts.
+const User = "user"
+
+// Disconnect, returned by a Handler, drops the connection without an exit
+// status, like a reboot does.
+const Disconnect = -1
+
+// Exec is a command received by the server. Command is empty for a shell.
+type Exec struct {
+	Command string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Handler runs a command and returns its exit status.
+type Handler func(Exec) int
+
+// Server is an SSH server listening on 127.0.0.1.
+type Server struct {
+	Addr string
+	// KeyPath is a private key the server accepts for User.
+	KeyPath string
+	// HostKey is the key the server identifies itself with.
+	HostKey ssh.PublicKey
+
+	mu       sync.Mutex
+	handler  Handler
+	commands []string
+	conns    int
+	config   *ssh.ServerConfig
+	files    map[string][]byte
+	redirect map[string]string
+}
+
+// NewServer starts a server that runs every command with handler. It is
+// stopped when the test ends.
+func NewServer(t testing.TB, handler Handler) *Server {
+	t.Helper()
+
+	hostSigner := newSigner(t)
+	userPub, userPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(userPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == User && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %v", meta.User())
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &Server{
+		Addr:     ln.Addr().String(),
+		KeyPath:  keyPath,
+		HostKey:  hostSigner.PublicKey(),
+		handler:  handler,
+		config:   cfg,
+		files:    map[string][]byte{},
+		redirect: map[string]string{},
+	}
+	go func() {
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(raw)
+		}
+	}()
+	return s
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return port
+}
+
+// Commands returns the commands run so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Conns returns the number of connections accepted so far.
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// RotateHostKey makes the server present a new host key to later
+// connections.
+func (s *Server) RotateHostKey(t testing.TB) {
+	t.Helper()
+
+	signer := newSigner(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg := *s.config
+	cfg.AddHostKey(signer)
+	s.config = &cfg
+	s.HostKey = signer.PublicKey()
+}
+
+func newSigner(t testing.TB) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func (s *Server) serve(raw net.Conn) {
+	s.mu.Lock()
+	cfg := s.config
+	s.mu.Unlock()
+
+	conn, chans, reqs, err := ssh.NewServerConn(raw, cfg)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go globalRequests(conn, reqs)
+
+	for newChan := range chans {
+		switch newChan.ChannelType() {
+		case "session":
+		case "direct-tcpip":
+			go s.directTCPIP(newChan)
+			continue
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(conn, ch, requests)
+	}
+}
+
+func (s *Server) session(conn *ssh.ServerConn, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range requests {
+		var command string
+		switch req.Type {
+		case "pty-req", "env", "window-change":
+			req.Reply(true, nil)
+			continue
+		case "shell":
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			command = payload.Command
+		default:
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		e := Exec{Command: command, Stdin: ch, Stdout: ch, Stderr: ch.Stderr()}
+		status, ok := s.builtin(e)
+		if !ok {
+			status = s.handler(e)
+		}
+		if status == Disconnect {
+			conn.Close()
+			return
+		}
+
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, uint32(status))
+		ch.SendRequest("exit-status", false, payload)
+		return
+	}
+}
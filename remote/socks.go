@@ -0,0 +1,131 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS runs a SOCKS5 proxy on local whose connections leave from the
+// server, like ssh -D. Only CONNECT without authentication is supported.
+// It returns the address it listens on and serves until ctx is done.
+func (c *Client) SOCKS(ctx context.Context, local string) (net.Addr, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	go func() {
+		for {
+			in, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				target, err := socksHandshake(in)
+				if err != nil {
+					in.Close()
+					return
+				}
+
+				out, err := conn.Dial("tcp", target)
+				if err != nil {
+					// General failure.
+					in.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					in.Close()
+					return
+				}
+
+				// Succeeded, bound to 0.0.0.0:0.
+				if _, err := in.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+					in.Close()
+					out.Close()
+					return
+				}
+				pipe(in, out)
+			}()
+		}
+	}()
+
+	return ln.Addr(), nil
+}
+
+// socksHandshake negotiates a SOCKS5 CONNECT and returns its target. It
+// reads exactly the handshake from conn so that data the client sends
+// right after it is left for the tunnel.
+func socksHandshake(conn net.Conn) (string, error) {
+	var greeting [2]byte
+	if _, err := io.ReadFull(conn, greeting[:]); err != nil {
+		return "", err
+	}
+	if greeting[0] != 5 {
+		return "", fmt.Errorf("unsupported SOCKS version %v", greeting[0])
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	// No authentication required.
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return "", err
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return "", err
+	}
+	if req[1] != 1 {
+		// Command not supported.
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return "", errors.New("only SOCKS CONNECT is supported")
+	}
+
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	case 4:
+		ip := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	default:
+		return "", fmt.Errorf("unsupported SOCKS address type %v", req[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
@@ -0,0 +1,93 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// File is a file to upload.
+type File struct {
+	Name string
+	Mode fs.FileMode
+	Data []byte
+}
+
+// Quote quotes s for a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Upload copies files into dir on the server with the SCP protocol. dir
+// must exist.
+func (c *Client) Upload(ctx context.Context, dir string, files ...File) error {
+	session, err := c.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	acks := bufio.NewReader(stdout)
+
+	command := "scp -qt -- " + Quote(dir)
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	send := func() error {
+		if err := readAck(acks); err != nil {
+			return err
+		}
+		for _, f := range files {
+			if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", f.Mode.Perm(), len(f.Data), f.Name); err != nil {
+				return err
+			}
+			if err := readAck(acks); err != nil {
+				return fmt.Errorf("%v: %w", f.Name, err)
+			}
+			if _, err := stdin.Write(append(f.Data, 0)); err != nil {
+				return err
+			}
+			if err := readAck(acks); err != nil {
+				return fmt.Errorf("%v: %w", f.Name, err)
+			}
+		}
+		return stdin.Close()
+	}
+
+	if err := send(); err != nil {
+		session.Close()
+		return fmt.Errorf("scp to %v: %w", dir, err)
+	}
+	return wait(ctx, session, command)
+}
+
+// readAck reads an SCP acknowledgement: a zero byte, or 1 or 2 followed by
+// an error message.
+func readAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrDisconnected
+		}
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+
+	msg, _ := r.ReadString('\n')
+	return errors.New(strings.TrimSpace(msg))
+}
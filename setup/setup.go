@@ -0,0 +1,9 @@
+// Package setup holds the files that prepare a server for Wolf.
+package setup
+
+import "embed"
+
+// Files are uploaded to the server by `setup`.
+//
+//go:embed setup.sh *.rules
+var Files embed.FS
@@ -0,0 +1,103 @@
+// Package state keeps td-stream's local state, such as provisioning
+// progress, as JSON files under the user's config directory.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir returns the directory state files are kept in.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "td-stream"), nil
+}
+
+// Path returns the location of the state file name, e.g. "up/gaming.json".
+// Names that lead outside the state directory are rejected.
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid state name %q", name)
+	}
+	return path, nil
+}
+
+// Load decodes the state file name into v. A missing file leaves v as is.
+func Load(name string, v interface{}) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("reading state %v: %w", path, err)
+	}
+	return nil
+}
+
+// Save writes v to the state file name. The file is replaced atomically so
+// an interrupted run never leaves it half written.
+func Save(name string, v interface{}) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remove deletes the state file name. A missing file is not an error.
+func Remove(name string) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
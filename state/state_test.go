@@ -0,0 +1,66 @@
+package state
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	type progress struct {
+		Server string
+		Steps  []string
+	}
+
+	var got progress
+	if err := Load("up/gaming.json", &got); err != nil {
+		t.Fatalf("Load missing: %v", err)
+	}
+
+	want := progress{Server: "abc", Steps: []string{"deploy", "nvidia"}}
+	if err := Save("up/gaming.json", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	path, _ := Path("up/gaming.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	if err := Load("up/gaming.json", &got); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.Server != want.Server || len(got.Steps) != 2 {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	if err := Remove("up/gaming.json"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := Remove("up/gaming.json"); err != nil {
+		t.Fatalf("Remove missing: %v", err)
+	}
+}
+
+func TestPathOutsideDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	for _, name := range []string{"../x.json", "up/../../x.json", "..", ""} {
+		if _, err := Path(name); err == nil {
+			t.Errorf("Path(%q) accepted a name outside the state directory", name)
+		}
+		if err := Save(name, 1); err == nil {
+			t.Errorf("Save(%q) accepted a name outside the state directory", name)
+		}
+	}
+	if _, err := Path("up/gaming.json"); err != nil {
+		t.Errorf("Path(up/gaming.json): %v", err)
+	}
+}
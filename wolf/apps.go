@@ -0,0 +1,265 @@
+package wolf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// GPUs are the GPU vendors the app templates know about.
+var GPUs = []string{"nvidia", "amd", "intel"}
+
+// baseCreateJSON grants app containers what games-on-whales images need to
+// run their own compositor and input devices.
+const baseCreateJSON = `{
+  "HostConfig": {
+    "IpcMode": "host",
+    "CapAdd": ["SYS_ADMIN", "SYS_NICE", "SYS_PTRACE", "NET_RAW", "MKNOD", "NET_ADMIN"],
+    "SecurityOpt": ["seccomp=unconfined", "apparmor=unconfined"],
+    "Ulimits": [{"Name": "nofile", "Hard": 10240, "Soft": 10240}],
+    "Privileged": false,
+    "DeviceCgroupRules": ["c 13:* rmw", "c 244:* rmw"]
+  }
+}
+`
+
+// requiredDevices is the GOW_REQUIRED_DEVICES of the templates. Template
+// narrows it to the GPU the app is set up for.
+const requiredDevices = "GOW_REQUIRED_DEVICES=/dev/input/* /dev/dri/* /dev/nvidia*"
+
+// Templates are the games-on-whales apps `wolf apps add` knows by name.
+// Steam and Lutris share a game library on the host, so every paired
+// client sees the games the others installed; Steam Input needs uinput and
+// uhid to emulate controllers. The images publish no ports.
+var Templates = map[string]App{
+	"steam": {
+		Title:                  "Steam",
+		StartVirtualCompositor: true,
+		Runner: Runner{
+			Type:           "docker",
+			Name:           "WolfSteam",
+			Image:          "ghcr.io/games-on-whales/steam:edge",
+			Mounts:         []string{"/etc/wolf/games/steam:/mnt/games:rw"},
+			Env:            []string{"PROTON_LOG=1", "RUN_GAMESCOPE=1", requiredDevices},
+			Devices:        []string{"/dev/uinput", "/dev/uhid"},
+			BaseCreateJSON: baseCreateJSON,
+		},
+	},
+	"firefox": {
+		Title:                  "Firefox",
+		StartVirtualCompositor: true,
+		Runner: Runner{
+			Type:           "docker",
+			Name:           "WolfFirefox",
+			Image:          "ghcr.io/games-on-whales/firefox:edge",
+			Env:            []string{"RUN_SWAY=1", "MOZ_ENABLE_WAYLAND=1", requiredDevices},
+			BaseCreateJSON: baseCreateJSON,
+		},
+	},
+	"retroarch": {
+		Title:                  "RetroArch",
+		StartVirtualCompositor: true,
+		Runner: Runner{
+			Type:           "docker",
+			Name:           "WolfRetroarch",
+			Image:          "ghcr.io/games-on-whales/retroarch:edge",
+			Env:            []string{"RUN_SWAY=1", requiredDevices},
+			BaseCreateJSON: baseCreateJSON,
+		},
+	},
+	"lutris": {
+		Title:                  "Lutris",
+		StartVirtualCompositor: true,
+		Runner: Runner{
+			Type:           "docker",
+			Name:           "WolfLutris",
+			Image:          "ghcr.io/games-on-whales/lutris:edge",
+			Mounts:         []string{"/etc/wolf/games/lutris:/mnt/games:rw"},
+			Env:            []string{"RUN_SWAY=1", requiredDevices},
+			BaseCreateJSON: baseCreateJSON,
+		},
+	},
+}
+
+// TemplateNames returns the names of the templates in order.
+func TemplateNames() []string {
+	names := make([]string, 0, len(Templates))
+	for name := range Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Template returns a copy of the named template set up for a GPU vendor.
+func Template(name, gpu string) (App, error) {
+	app, ok := Templates[strings.ToLower(name)]
+	if !ok {
+		return App{}, fmt.Errorf("unknown app template %q, want one of %v", name, strings.Join(TemplateNames(), ", "))
+	}
+
+	r := &app.Runner
+	for _, list := range []*[]string{&r.Mounts, &r.Env, &r.Devices, &r.Ports} {
+		*list = append([]string(nil), *list...)
+	}
+	devices, err := RequiredDevices(gpu)
+	if err != nil {
+		return App{}, err
+	}
+	SetEnv(&r.Env, "GOW_REQUIRED_DEVICES", devices)
+	return app, nil
+}
+
+// RequiredDevices is the GOW_REQUIRED_DEVICES value for a GPU vendor: the
+// device nodes the app's container waits for before it starts.
+func RequiredDevices(gpu string) (string, error) {
+	switch gpu {
+	case "nvidia":
+		return "/dev/input/* /dev/dri/* /dev/nvidia*", nil
+	case "amd", "intel":
+		return "/dev/input/* /dev/dri/*", nil
+	}
+	return "", fmt.Errorf("unknown GPU %q, want one of %v", gpu, strings.Join(GPUs, ", "))
+}
+
+// SetEnv sets NAME=value in env, replacing an earlier value of NAME.
+func SetEnv(env *[]string, name, value string) {
+	for i, kv := range *env {
+		if strings.SplitN(kv, "=", 2)[0] == name {
+			(*env)[i] = name + "=" + value
+			return
+		}
+	}
+	*env = append(*env, name+"="+value)
+}
+
+// ParseApps reads app definitions: either a single app, with title and
+// runner at the top level, or [[apps]] tables as in config.toml.
+func ParseApps(data []byte) ([]App, error) {
+	var file struct {
+		Apps []App `toml:"apps"`
+		App
+	}
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Apps) > 0 {
+		return file.Apps, nil
+	}
+	if file.Title == "" && file.Runner.Type == "" {
+		return nil, fmt.Errorf("no app found, define title and [runner] or [[apps]]")
+	}
+	return []App{file.App}, nil
+}
+
+// apps returns the [[apps]] tables of the document.
+func (d *Document) apps() ([]interface{}, error) {
+	v, ok := d.tree["apps"]
+	if !ok {
+		return nil, nil
+	}
+	apps, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("apps is a %T, not an array of tables", v)
+	}
+	return apps, nil
+}
+
+// FindApp returns the index of the app titled title, ignoring case, or -1.
+func (d *Document) FindApp(title string) (int, error) {
+	cfg, err := d.Config()
+	if err != nil {
+		return -1, err
+	}
+	for i, app := range cfg.Apps {
+		if strings.EqualFold(app.Title, title) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// AddApp appends app to the document, after the last app.
+func (d *Document) AddApp(app App) error {
+	i, err := d.FindApp(app.Title)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		return fmt.Errorf("an app titled %q already exists", app.Title)
+	}
+
+	apps, err := d.apps()
+	if err != nil {
+		return err
+	}
+	p := len(d.src)
+	stmts := scan(d.src)
+	for h, s := range stmts {
+		if s.path[0] != "apps" {
+			continue
+		}
+		if !s.header && len(s.path) == 1 {
+			// apps is an inline array.
+			table := map[string]interface{}{}
+			if err := convert(app, &table); err != nil {
+				return err
+			}
+			return d.put("apps", append(apps, table))
+		}
+		if len(s.name) == 1 {
+			p = regionEnd(stmts, h)
+		}
+	}
+
+	block, err := toml.Marshal(struct {
+		Apps []App `toml:"apps"`
+	}{[]App{app}})
+	if err != nil {
+		return err
+	}
+	return d.insertBlock(p, string(block))
+}
+
+// RemoveApp removes the app titled title and reports whether it existed.
+func (d *Document) RemoveApp(title string) (bool, error) {
+	i, err := d.FindApp(title)
+	if err != nil || i < 0 {
+		return false, err
+	}
+	return true, d.remove(fmt.Sprintf("apps.%v", i))
+}
+
+// UpdateApp applies update to the app titled title. Only the keys update
+// changes are written; keys of the app that App has no field for are kept.
+func (d *Document) UpdateApp(title string, update func(*App) error) error {
+	i, err := d.FindApp(title)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return fmt.Errorf("no app titled %q", title)
+	}
+	cfg, err := d.Config()
+	if err != nil {
+		return err
+	}
+
+	app := cfg.Apps[i]
+	before := map[string]interface{}{}
+	if err := convert(app, &before); err != nil {
+		return err
+	}
+	if err := update(&app); err != nil {
+		return err
+	}
+	// Fields left empty are omitted from after, so clearing a list
+	// removes its key.
+	after := map[string]interface{}{}
+	if err := convert(app, &after); err != nil {
+		return err
+	}
+	return d.apply(fmt.Sprintf("apps.%v", i), before, after)
+}
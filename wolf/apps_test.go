@@ -0,0 +1,112 @@
+package wolf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	app, err := Template("Steam", "amd")
+	if err != nil {
+		t.Fatalf("Template: %v", err)
+	}
+	if !contains(app.Runner.Env, "GOW_REQUIRED_DEVICES=/dev/input/* /dev/dri/*") {
+		t.Errorf("env = %v", app.Runner.Env)
+	}
+	if !contains(app.Runner.Mounts, "/etc/wolf/games/steam:/mnt/games:rw") {
+		t.Errorf("mounts = %v", app.Runner.Mounts)
+	}
+	if !contains(app.Runner.Devices, "/dev/uinput") || !contains(app.Runner.Devices, "/dev/uhid") {
+		t.Errorf("devices = %v", app.Runner.Devices)
+	}
+	if err := (Config{Hostname: "Wolf", Apps: []App{app}}).Validate(); err != nil {
+		t.Errorf("template does not validate: %v", err)
+	}
+
+	// Templates are copied, not shared.
+	app.Runner.Devices[0] = "/dev/null"
+	steam := Templates["steam"].Runner
+	if !contains(steam.Env, "GOW_REQUIRED_DEVICES=/dev/input/* /dev/dri/* /dev/nvidia*") || steam.Devices[0] != "/dev/uinput" {
+		t.Errorf("Template modified the shared template: %+v", steam)
+	}
+
+	for _, name := range TemplateNames() {
+		app, err := Template(name, "nvidia")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !contains(app.Runner.Env, "GOW_REQUIRED_DEVICES=/dev/input/* /dev/dri/* /dev/nvidia*") {
+			t.Errorf("%v env = %v", name, app.Runner.Env)
+		}
+	}
+
+	if _, err := Template("doom", "nvidia"); err == nil {
+		t.Error("unknown template accepted")
+	}
+	if _, err := Template("steam", "voodoo"); err == nil {
+		t.Error("unknown GPU accepted")
+	}
+}
+
+func TestParseApps(t *testing.T) {
+	single := "title = \"Kodi\"\n[runner]\ntype = \"docker\"\nname = \"WolfKodi\"\nimage = \"kodi\"\n"
+	apps, err := ParseApps([]byte(single))
+	if err != nil || len(apps) != 1 || apps[0].Runner.Image != "kodi" {
+		t.Errorf("ParseApps(single) = %+v, %v", apps, err)
+	}
+
+	many := "[[apps]]\ntitle = \"A\"\n[apps.runner]\ntype = \"process\"\nrun_cmd = \"a\"\n" +
+		"[[apps]]\ntitle = \"B\"\n[apps.runner]\ntype = \"process\"\nrun_cmd = \"b\"\n"
+	if apps, err := ParseApps([]byte(many)); err != nil || len(apps) != 2 {
+		t.Errorf("ParseApps(many) = %+v, %v", apps, err)
+	}
+
+	if _, err := ParseApps([]byte("hostname = \"x\"\n")); err == nil {
+		t.Error("ParseApps accepted a file without apps")
+	}
+}
+
+func TestUpdateApp(t *testing.T) {
+	doc, err := ParseDocument([]byte(testConfig + "\n[apps.video]\nsource = \"custom\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = doc.UpdateApp("firefox", func(app *App) error {
+		app.Runner.Image = "firefox:stable"
+		app.Runner.Env = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateApp: %v", err)
+	}
+
+	if v, _ := doc.Get("apps.0.runner.image"); v != "firefox:stable" {
+		t.Errorf("image = %v", v)
+	}
+	if _, err := doc.Get("apps.0.runner.env"); err == nil {
+		t.Error("clearing env did not remove it")
+	}
+	if v, _ := doc.Get("apps.0.video.source"); v != "custom" {
+		t.Errorf("apps.0.video.source = %v, want the untyped key kept", v)
+	}
+
+	if err := doc.AddApp(App{Title: "FIREFOX"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("AddApp of a duplicate title = %v", err)
+	}
+	if removed, err := doc.RemoveApp("Firefox"); !removed || err != nil {
+		t.Fatalf("RemoveApp = %v, %v", removed, err)
+	}
+	if cfg, _ := doc.Config(); len(cfg.Apps) != 0 {
+		t.Errorf("apps after RemoveApp = %+v", cfg.Apps)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package wolf
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ConfigPath is where Wolf reads its configuration on the server.
+const ConfigPath = "/etc/wolf/cfg/config.toml"
+
+// Config is the part of config.toml td-stream understands.
+type Config struct {
+	ConfigVersion int            `toml:"config_version"`
+	Hostname      string         `toml:"hostname"`
+	UUID          string         `toml:"uuid"`
+	PairedClients []PairedClient `toml:"paired_clients"`
+	Apps          []App          `toml:"apps"`
+}
+
+// PairedClient is a Moonlight client Wolf accepts.
+type PairedClient struct {
+	ClientCert     string `toml:"client_cert"`
+	AppStateFolder string `toml:"app_state_folder,omitempty"`
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the client certificate.
+func (c PairedClient) Fingerprint() (string, error) {
+	block, _ := pem.Decode([]byte(c.ClientCert))
+	if block == nil {
+		return "", fmt.Errorf("client_cert is not a PEM certificate")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(block.Bytes)), nil
+}
+
+// App is an application Moonlight can launch.
+type App struct {
+	Title                  string `toml:"title"`
+	IconPNGPath            string `toml:"icon_png_path,omitempty"`
+	StartVirtualCompositor bool   `toml:"start_virtual_compositor"`
+	Runner                 Runner `toml:"runner"`
+}
+
+// Runner starts an App, either as a Docker container or as a process.
+type Runner struct {
+	Type           string   `toml:"type"`
+	Name           string   `toml:"name,omitempty"`
+	Image          string   `toml:"image,omitempty"`
+	Mounts         []string `toml:"mounts,omitempty"`
+	Env            []string `toml:"env,omitempty"`
+	Devices        []string `toml:"devices,omitempty"`
+	Ports          []string `toml:"ports,omitempty"`
+	BaseCreateJSON string   `toml:"base_create_json,omitempty"`
+	RunCmd         string   `toml:"run_cmd,omitempty"`
+}
+
+// ValidationError lists every problem found in a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid wolf config:\n  - %v", strings.Join(e.Problems, "\n  - "))
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks what Wolf would reject or fail on at runtime. It returns a
+// *ValidationError or nil.
+func (cfg Config) Validate() error {
+	e := &ValidationError{}
+
+	if strings.TrimSpace(cfg.Hostname) == "" {
+		e.add("hostname is empty")
+	}
+
+	for i, client := range cfg.PairedClients {
+		block, _ := pem.Decode([]byte(client.ClientCert))
+		if block == nil {
+			e.add("paired client %v: client_cert is not a PEM certificate", i)
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			e.add("paired client %v: client_cert: %v", i, err)
+		}
+	}
+
+	titles := map[string]bool{}
+	for i, app := range cfg.Apps {
+		name := app.Title
+		if strings.TrimSpace(name) == "" {
+			name = strconv.Itoa(i)
+			e.add("app %v: title is empty", name)
+		} else if titles[strings.ToLower(name)] {
+			e.add("app %v: title is used by another app", name)
+		}
+		titles[strings.ToLower(name)] = true
+
+		r := app.Runner
+		switch r.Type {
+		case "docker":
+			if r.Name == "" {
+				e.add("app %v: docker runner needs a container name", name)
+			}
+			if r.Image == "" {
+				e.add("app %v: docker runner needs an image", name)
+			}
+			for _, m := range r.Mounts {
+				if parts := strings.Split(m, ":"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+					e.add("app %v: mount %q is not source:destination[:mode]", name, m)
+				}
+			}
+			for _, env := range r.Env {
+				if !strings.Contains(env, "=") {
+					e.add("app %v: env %q is not NAME=value", name, env)
+				}
+			}
+		case "process":
+			if strings.TrimSpace(r.RunCmd) == "" {
+				e.add("app %v: process runner needs run_cmd", name)
+			}
+		default:
+			e.add("app %v: unknown runner type %q, want docker or process", name, r.Type)
+		}
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+// Document is a config.toml as read from the server. Changes are made to
+// the lines of the source that hold the changed keys, so comments, key
+// order and settings td-stream has no type for, like the GStreamer
+// pipelines, are kept as they were.
+type Document struct {
+	src  []byte
+	tree map[string]interface{}
+}
+
+// ParseDocument parses the contents of config.toml.
+func ParseDocument(data []byte) (*Document, error) {
+	d := &Document{}
+	if err := d.parse(data); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Document) parse(src []byte) error {
+	tree := map[string]interface{}{}
+	if err := toml.Unmarshal(src, &tree); err != nil {
+		return fmt.Errorf("parsing wolf config: %w", err)
+	}
+	d.src, d.tree = src, tree
+	return nil
+}
+
+// Marshal returns the document as TOML: the source it was parsed from with
+// the changes made since.
+func (d *Document) Marshal() ([]byte, error) {
+	return append([]byte(nil), d.src...), nil
+}
+
+// Config decodes the typed part of the document.
+func (d *Document) Config() (Config, error) {
+	var cfg Config
+	if err := convert(d.tree, &cfg); err != nil {
+		return cfg, fmt.Errorf("decoding wolf config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate decodes and validates the document.
+func (d *Document) Validate() error {
+	cfg, err := d.Config()
+	if err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// convert copies v into out through TOML, so out only needs toml tags.
+func convert(v, out interface{}) error {
+	data, err := toml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return toml.Unmarshal(data, out)
+}
+
+// Get returns the value at a dotted key such as "hostname" or
+// "apps.0.runner.image". Array elements are addressed by index.
+func (d *Document) Get(key string) (interface{}, error) {
+	var v interface{} = d.tree
+	for _, part := range strings.Split(key, ".") {
+		next, err := child(v, part)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", key, err)
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// Set stores value at a dotted key. value is parsed as a TOML value, so
+// "true", "42" and `["a", "b"]` keep their types; anything that is not
+// valid TOML is stored as a string. Missing tables are created.
+func (d *Document) Set(key, value string) error {
+	return d.put(key, parseValue(value))
+}
+
+func (d *Document) set(key string, value interface{}) error {
+	parts := strings.Split(key, ".")
+	var parent interface{} = d.tree
+	for _, part := range parts[:len(parts)-1] {
+		if t, ok := parent.(map[string]interface{}); ok && t[part] == nil {
+			t[part] = map[string]interface{}{}
+		}
+		next, err := child(parent, part)
+		if err != nil {
+			return fmt.Errorf("%v: %w", key, err)
+		}
+		parent = next
+	}
+
+	last := parts[len(parts)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+	case []interface{}:
+		i, err := index(p, last)
+		if err != nil {
+			return fmt.Errorf("%v: %w", key, err)
+		}
+		p[i] = value
+	default:
+		return fmt.Errorf("%v: %T is not a table or array", key, parent)
+	}
+	return nil
+}
+
+func child(v interface{}, part string) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		next, ok := t[part]
+		if !ok {
+			return nil, fmt.Errorf("no key %q", part)
+		}
+		return next, nil
+	case []interface{}:
+		i, err := index(t, part)
+		if err != nil {
+			return nil, err
+		}
+		return t[i], nil
+	}
+	return nil, fmt.Errorf("%q: %T is not a table or array", part, v)
+}
+
+func index(a []interface{}, part string) (int, error) {
+	i, err := strconv.Atoi(part)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an array index", part)
+	}
+	if i < 0 || i >= len(a) {
+		return 0, fmt.Errorf("index %v out of range, the array has %v elements", i, len(a))
+	}
+	return i, nil
+}
+
+func parseValue(value string) interface{} {
+	var doc struct {
+		V interface{} `toml:"v"`
+	}
+	if err := toml.Unmarshal([]byte("v = "+value), &doc); err != nil || doc.V == nil {
+		return value
+	}
+	return doc.V
+}
@@ -0,0 +1,226 @@
+package wolf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testConfig = `config_version = 4
+hostname = "Wolf"
+uuid = "0b1e5b5c-6f55-4f2e-8a8b-6d1f4f1e0a11"
+paired_clients = []
+
+[[apps]]
+title = "Firefox"
+start_virtual_compositor = true
+
+  [apps.runner]
+  type = "docker"
+  name = "WolfFirefox"
+  image = "ghcr.io/games-on-whales/firefox:edge"
+  env = ["RUN_SWAY=1"]
+  mounts = []
+
+[gstreamer.video]
+default_source = "waylanddisplaysrc name=wolf_wayland_source render_node={render_node}"
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	doc, err := ParseDocument([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+
+	if err := doc.Set("apps.0.runner.image", "ghcr.io/games-on-whales/firefox:stable"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := doc.Set("apps.0.start_virtual_compositor", "false"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	data, err := doc.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	doc, err = ParseDocument(data)
+	if err != nil {
+		t.Fatalf("ParseDocument(Marshal()): %v\n%s", err, data)
+	}
+
+	cfg, err := doc.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	app := cfg.Apps[0]
+	if app.Runner.Image != "ghcr.io/games-on-whales/firefox:stable" || app.StartVirtualCompositor {
+		t.Errorf("app after Set = %+v", app)
+	}
+
+	// Settings without a type survive.
+	source, err := doc.Get("gstreamer.video.default_source")
+	if err != nil || !strings.HasPrefix(source.(string), "waylanddisplaysrc") {
+		t.Errorf("gstreamer.video.default_source = %v, %v", source, err)
+	}
+}
+
+func TestDocumentKeepsLayout(t *testing.T) {
+	const config = `# Wolf config, edited by hand
+uuid = "0b1e5b5c-6f55-4f2e-8a8b-6d1f4f1e0a11"
+hostname = "Wolf" # shown in Moonlight
+config_version = 4
+
+[[apps]]
+title = "Firefox"
+
+  [apps.runner]
+  type = "docker"
+  name = "WolfFirefox"
+  # pinned until the next release
+  image = "ghcr.io/games-on-whales/firefox:edge"
+  env = [
+    "RUN_SWAY=1", # needed for sway
+  ]
+
+[gstreamer.video]
+default_source = "videotestsrc"
+`
+	doc, err := ParseDocument([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"hostname":                       "Gaming",
+		"apps.0.runner.image":            "ghcr.io/games-on-whales/firefox:stable",
+		"apps.0.runner.devices":          `["/dev/dri"]`,
+		"gstreamer.audio.default_source": "pulsesrc",
+	} {
+		if err := doc.Set(key, value); err != nil {
+			t.Fatalf("Set(%q): %v", key, err)
+		}
+	}
+
+	const want = `# Wolf config, edited by hand
+uuid = "0b1e5b5c-6f55-4f2e-8a8b-6d1f4f1e0a11"
+hostname = 'Gaming' # shown in Moonlight
+config_version = 4
+
+[[apps]]
+title = "Firefox"
+
+  [apps.runner]
+  type = "docker"
+  name = "WolfFirefox"
+  # pinned until the next release
+  image = 'ghcr.io/games-on-whales/firefox:stable'
+  env = [
+    "RUN_SWAY=1", # needed for sway
+  ]
+  devices = ['/dev/dri']
+
+[gstreamer.video]
+default_source = "videotestsrc"
+
+[gstreamer.audio]
+default_source = 'pulsesrc'
+`
+	data, _ := doc.Marshal()
+	if string(data) != want {
+		t.Errorf("after Set:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Adding and removing an app leaves the rest alone.
+	app, err := Template("steam", "nvidia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.AddApp(app); err != nil {
+		t.Fatalf("AddApp: %v", err)
+	}
+	if i, _ := doc.FindApp("Steam"); i != 1 {
+		t.Errorf("Steam is app %v, want 1", i)
+	}
+	if removed, err := doc.RemoveApp("Steam"); !removed || err != nil {
+		t.Fatalf("RemoveApp = %v, %v", removed, err)
+	}
+	if data, _ := doc.Marshal(); string(data) != want {
+		t.Errorf("after AddApp and RemoveApp:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestDocumentGetSet(t *testing.T) {
+	doc, err := ParseDocument([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"missing":             "no key",
+		"apps.1.title":        "out of range",
+		"apps.x.title":        "not an array index",
+		"hostname.nested":     "not a table",
+		"apps.0.runner.image": "",
+	} {
+		_, err := doc.Get(key)
+		if want == "" {
+			if err != nil {
+				t.Errorf("Get(%q): %v", key, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Get(%q) err = %v, want %q", key, err, want)
+		}
+	}
+
+	if err := doc.Set("hostname.nested", "1"); err == nil {
+		t.Error("Set through a string succeeded")
+	}
+	if err := doc.Set("gstreamer.audio.default_source", "pulsesrc"); err != nil {
+		t.Errorf("Set in a new table: %v", err)
+	}
+	if v, _ := doc.Get("config_version"); v != int64(4) {
+		t.Errorf("config_version = %#v, want int64(4)", v)
+	}
+	if err := doc.Set("config_version", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := doc.Get("config_version"); v != int64(5) {
+		t.Errorf("config_version = %#v after Set, want int64(5)", v)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{
+		Hostname:      "Wolf",
+		PairedClients: []PairedClient{{ClientCert: "not a certificate"}},
+		Apps: []App{
+			{Title: "Firefox", Runner: Runner{Type: "docker", Name: "WolfFirefox", Image: "firefox", Mounts: []string{"/data"}}},
+			{Title: "firefox", Runner: Runner{Type: "process", RunCmd: "sh"}},
+			{Title: "", Runner: Runner{Type: "vm"}},
+		},
+	}
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want a *ValidationError", err)
+	}
+	for _, want := range []string{
+		"paired client 0: client_cert is not a PEM certificate",
+		`app Firefox: mount "/data" is not source:destination[:mode]`,
+		"app firefox: title is used by another app",
+		"app 2: title is empty",
+		`app 2: unknown runner type "vm"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v\nmissing %q", err, want)
+		}
+	}
+
+	cfg.PairedClients = nil
+	cfg.Apps = cfg.Apps[1:2]
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() of a valid config = %v", err)
+	}
+}
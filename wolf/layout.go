@@ -0,0 +1,529 @@
+package wolf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// statement is a table header or a key/value pair of a TOML document.
+type statement struct {
+	// path is the key from the root, with the elements of arrays of tables
+	// addressed by index, e.g. apps 0 runner for [apps.runner].
+	path []string
+	// name is the key of a header as written, e.g. apps runner.
+	name   []string
+	header bool
+	indent string
+	// start and end span the lines of the statement, including the comment
+	// lines right above it.
+	start, end int
+	// value and valueEnd span the value of a key/value pair.
+	value, valueEnd int
+}
+
+// scan splits a valid TOML document into statements.
+func scan(src []byte) []statement {
+	var stmts []statement
+	var table []string
+	arrays := map[string]int{}
+	comments := -1
+	for p := 0; p < len(src); {
+		line := p
+		p = skipSpace(src, p)
+		switch {
+		case p == len(src) || src[p] == '\n' || src[p] == '\r':
+			comments = -1
+			p = lineEnd(src, p)
+			continue
+		case src[p] == '#':
+			if comments < 0 {
+				comments = line
+			}
+			p = lineEnd(src, p)
+			continue
+		}
+
+		s := statement{indent: string(src[line:p]), start: line}
+		if comments >= 0 {
+			s.start, comments = comments, -1
+		}
+
+		if src[p] != '[' {
+			key, q := scanKey(src, p)
+			s.path = append(append([]string(nil), table...), key...)
+			s.value = skipSpace(src, q+1)
+			s.valueEnd = skipValue(src, s.value)
+			s.end = lineEnd(src, s.valueEnd)
+			stmts = append(stmts, s)
+			p = s.end
+			continue
+		}
+
+		array := bytes.HasPrefix(src[p:], []byte("[["))
+		p++
+		if array {
+			p++
+		}
+		s.name, p = scanKey(src, p)
+		s.header = true
+		table = nil
+		for i, part := range s.name {
+			table = append(table, part)
+			n, ok := arrays[strings.Join(table, ".")]
+			if array && i == len(s.name)-1 {
+				arrays[strings.Join(table, ".")] = n + 1
+				ok = true
+			} else {
+				n--
+			}
+			if ok {
+				table = append(table, strconv.Itoa(n))
+			}
+		}
+		s.path = table
+		s.end = lineEnd(src, p)
+		stmts = append(stmts, s)
+		p = s.end
+	}
+	return stmts
+}
+
+// scanKey reads a dotted key starting at p and returns it and the offset
+// after it.
+func scanKey(src []byte, p int) ([]string, int) {
+	var key []string
+	for {
+		p = skipSpace(src, p)
+		if p == len(src) {
+			return key, p
+		}
+		var part string
+		switch src[p] {
+		case '"':
+			end := skipString(src, p)
+			part, _ = strconv.Unquote(string(src[p:end]))
+			p = end
+		case '\'':
+			end := skipString(src, p)
+			part = string(src[p+1 : end-1])
+			p = end
+		default:
+			end := p
+			for end < len(src) && isBareKey(src[end]) {
+				end++
+			}
+			part, p = string(src[p:end]), end
+		}
+		key = append(key, part)
+
+		p = skipSpace(src, p)
+		if p == len(src) || src[p] != '.' {
+			return key, p
+		}
+		p++
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// skipString returns the offset after the string starting at p.
+func skipString(src []byte, p int) int {
+	q := src[p]
+	if delim := []byte{q, q, q}; bytes.HasPrefix(src[p:], delim) {
+		for i := p + 3; i < len(src); i++ {
+			if q == '"' && src[i] == '\\' {
+				i++
+				continue
+			}
+			if bytes.HasPrefix(src[i:], delim) {
+				// Up to two quotes may end the contents.
+				i += 3
+				for n := 0; n < 2 && i < len(src) && src[i] == q; n++ {
+					i++
+				}
+				return i
+			}
+		}
+		return len(src)
+	}
+
+	for i := p + 1; i < len(src); i++ {
+		if q == '"' && src[i] == '\\' {
+			i++
+			continue
+		}
+		if src[i] == q {
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// skipValue returns the offset after the value starting at p, which may
+// span lines.
+func skipValue(src []byte, p int) int {
+	if p == len(src) {
+		return p
+	}
+	switch src[p] {
+	case '"', '\'':
+		return skipString(src, p)
+	case '[', '{':
+		depth := 0
+		for i := p; i < len(src); i++ {
+			switch src[i] {
+			case '"', '\'':
+				i = skipString(src, i) - 1
+			case '#':
+				i = lineEnd(src, i) - 1
+			case '[', '{':
+				depth++
+			case ']', '}':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(src)
+	}
+
+	// Numbers, booleans and dates, which may contain a space.
+	end := p
+	for end < len(src) && src[end] != '\n' && src[end] != '#' {
+		end++
+	}
+	return len(bytes.TrimRight(src[:end], " \t\r"))
+}
+
+func skipSpace(src []byte, p int) int {
+	for p < len(src) && (src[p] == ' ' || src[p] == '\t') {
+		p++
+	}
+	return p
+}
+
+// lineEnd returns the offset of the line after the one p is on.
+func lineEnd(src []byte, p int) int {
+	if i := bytes.IndexByte(src[p:], '\n'); i >= 0 {
+		return p + i + 1
+	}
+	return len(src)
+}
+
+// isBlank reports whether the line starting at p is empty.
+func isBlank(src []byte, p int) bool {
+	return len(bytes.TrimSpace(src[p:lineEnd(src, p)])) == 0
+}
+
+// hasPrefix reports whether the key path starts with prefix.
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatKey writes a dotted key, quoting the parts that need it.
+func formatKey(key []string) string {
+	parts := make([]string, len(key))
+	for i, part := range key {
+		parts[i] = part
+		for j := 0; j < len(part); j++ {
+			if !isBareKey(part[j]) {
+				parts[i] = strconv.Quote(part)
+				break
+			}
+		}
+		if part == "" {
+			parts[i] = `""`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// encodeValue writes v as an inline TOML value.
+func encodeValue(v interface{}) (string, error) {
+	data, err := toml.Marshal(struct {
+		V interface{} `toml:"v,inline"`
+	}{v})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), "v = "), "\n"), nil
+}
+
+// regionEnd returns the end of the table header stmts[h] and the tables
+// inside it.
+func regionEnd(stmts []statement, h int) int {
+	end := stmts[h].end
+	for _, s := range stmts[h+1:] {
+		if s.header && !hasPrefix(s.path, stmts[h].path) {
+			break
+		}
+		end = s.end
+	}
+	return end
+}
+
+// splice replaces src[start:end] with text and parses the result.
+func (d *Document) splice(start, end int, text string) error {
+	src := make([]byte, 0, len(d.src)-(end-start)+len(text))
+	src = append(src, d.src[:start]...)
+	src = append(src, text...)
+	src = append(src, d.src[end:]...)
+	return d.parse(src)
+}
+
+// insertBlock inserts text at p, set apart from its neighbours by blank
+// lines.
+func (d *Document) insertBlock(p int, text string) error {
+	switch before := d.src[:p]; {
+	case len(before) == 0 || bytes.HasSuffix(before, []byte("\n\n")):
+	case bytes.HasSuffix(before, []byte("\n")):
+		text = "\n" + text
+	default:
+		text = "\n\n" + text
+	}
+	if p < len(d.src) && !isBlank(d.src, p) {
+		text += "\n"
+	}
+	return d.splice(p, p, text)
+}
+
+// put stores v at a dotted key. Only the lines holding the key change: the
+// value of an existing key is replaced in place, a new key is added after
+// the last one of its table, and a new table after the tables next to it.
+func (d *Document) put(key string, v interface{}) (err error) {
+	if err := d.set(key, v); err != nil {
+		return d.reset(err)
+	}
+	defer func() {
+		if err != nil {
+			err = d.reset(err)
+		}
+	}()
+
+	parts := strings.Split(key, ".")
+	stmts := scan(d.src)
+	for _, s := range stmts {
+		if hasPrefix(s.path, parts) && (s.header || len(s.path) > len(parts)) {
+			return fmt.Errorf("%v is a table, set the keys in it instead", key)
+		}
+		if !s.header && hasPrefix(parts, s.path) {
+			// The key itself, or an inline table or array holding it.
+			value, err := d.Get(strings.Join(s.path, "."))
+			if err != nil {
+				return err
+			}
+			text, err := encodeValue(value)
+			if err != nil {
+				return err
+			}
+			return d.splice(s.value, s.valueEnd, text)
+		}
+	}
+
+	text, err := encodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	// The deepest table holding the key, or the root.
+	h := -1
+	var table, name []string
+	for i, s := range stmts {
+		if s.header && hasPrefix(parts, s.path) && len(s.path) >= len(table) {
+			h, table, name = i, s.path, s.name
+		}
+	}
+	rest := parts[len(table):]
+
+	// The keys of a table run to the next header.
+	last, dotted := -1, false
+	for i := h + 1; i < len(stmts) && !stmts[i].header; i++ {
+		last = i
+		dotted = dotted || stmts[i].path[len(table)] == rest[0]
+	}
+	indent := ""
+	if last >= 0 {
+		indent = stmts[last].indent
+	} else if h >= 0 {
+		indent = stmts[h].indent
+	}
+
+	if len(rest) == 1 || dotted {
+		line := indent + formatKey(rest) + " = " + text + "\n"
+		switch {
+		case last >= 0:
+			p := stmts[last].end
+			if p > 0 && d.src[p-1] != '\n' {
+				line = "\n" + line
+			}
+			return d.splice(p, p, line)
+		case h >= 0:
+			return d.splice(stmts[h].end, stmts[h].end, line)
+		case len(stmts) > 0:
+			// Root keys must come before the first table.
+			return d.splice(stmts[0].start, stmts[0].start, line+"\n")
+		}
+		return d.insertBlock(len(d.src), line)
+	}
+
+	p := len(d.src)
+	if h >= 0 {
+		p = regionEnd(stmts, h)
+	}
+	header := append(append([]string(nil), name...), rest[:len(rest)-1]...)
+	return d.insertBlock(p, fmt.Sprintf("%v[%v]\n%v%v = %v\n", indent, formatKey(header), indent, formatKey(rest[len(rest)-1:]), text))
+}
+
+// remove deletes the value at a dotted key along with its lines. Removing
+// a missing key does nothing.
+func (d *Document) remove(key string) (err error) {
+	defer func() {
+		if err != nil {
+			err = d.reset(err)
+		}
+	}()
+
+	parts := strings.Split(key, ".")
+	stmts := scan(d.src)
+	type cut struct{ start, end int }
+	var cuts []cut
+	for i := 0; i < len(stmts); i++ {
+		s := stmts[i]
+		if !hasPrefix(s.path, parts) {
+			if !s.header && hasPrefix(parts, s.path) {
+				// An inline table or array holds the key.
+				value, err := d.Get(strings.Join(s.path, "."))
+				if err != nil {
+					return nil
+				}
+				text, err := encodeValue(without(value, parts[len(s.path):]))
+				if err != nil {
+					return err
+				}
+				return d.splice(s.value, s.valueEnd, text)
+			}
+			continue
+		}
+
+		if !s.header {
+			cuts = append(cuts, cut{s.start, s.end})
+			continue
+		}
+		// A table goes with the tables inside it and the blank lines
+		// after it.
+		c := cut{s.start, regionEnd(stmts, i)}
+		for c.end < len(d.src) && isBlank(d.src, c.end) {
+			c.end = lineEnd(d.src, c.end)
+		}
+		if c.end == len(d.src) {
+			for c.start > 0 {
+				prev := bytes.LastIndexByte(d.src[:c.start-1], '\n') + 1
+				if !isBlank(d.src, prev) {
+					break
+				}
+				c.start = prev
+			}
+		}
+		cuts = append(cuts, c)
+		for i+1 < len(stmts) && stmts[i+1].start < c.end {
+			i++
+		}
+	}
+	if len(cuts) == 0 {
+		return nil
+	}
+
+	var src []byte
+	p := 0
+	for _, c := range cuts {
+		src = append(src, d.src[p:c.start]...)
+		p = c.end
+	}
+	return d.parse(append(src, d.src[p:]...))
+}
+
+// without returns v with the element at the key path parts removed.
+func without(v interface{}, parts []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(parts) == 1 {
+			delete(t, parts[0])
+		} else if next, ok := t[parts[0]]; ok {
+			t[parts[0]] = without(next, parts[1:])
+		}
+	case []interface{}:
+		i, err := index(t, parts[0])
+		if err != nil {
+			return t
+		}
+		if len(parts) == 1 {
+			return append(t[:i:i], t[i+1:]...)
+		}
+		t[i] = without(t[i], parts[1:])
+	}
+	return v
+}
+
+// apply changes the table at key from before to after, touching only the
+// keys that differ.
+func (d *Document) apply(key string, before, after map[string]interface{}) error {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := d.remove(key + "." + k); err != nil {
+			return err
+		}
+	}
+
+	keys = keys[:0]
+	for k := range after {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		bt, ok := b.(map[string]interface{})
+		at, ok2 := a.(map[string]interface{})
+		if ok && ok2 {
+			if err := d.apply(key+"."+k, bt, at); err != nil {
+				return err
+			}
+			continue
+		}
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if err := d.put(key+"."+k, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset parses the source again, dropping changes made to the tree only,
+// and returns err.
+func (d *Document) reset(err error) error {
+	d.parse(d.src)
+	return err
+}
@@ -0,0 +1,19 @@
+// Package wolf holds the files that install Wolf on a server.
+package wolf
+
+import "embed"
+
+// Files are uploaded to the server by `wolf install`.
+//
+//go:embed docker-compose.nvidia.yml docker-nvidia-start.sh
+var Files embed.FS
+
+// InstallDir is where `wolf install` puts Files on the server.
+const InstallDir = "/home/user"
+
+// Image is Wolf's image. The compose file runs Image:DefaultTag unless
+// WOLF_IMAGE names another one.
+const (
+	Image      = "ghcr.io/games-on-whales/wolf"
+	DefaultTag = "stable"
+)